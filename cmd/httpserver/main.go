@@ -1,21 +1,27 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"httpfromtcp/docs" // Importar el paquete docs generado por swag
 	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/middleware"
+	"httpfromtcp/internal/negotiate"
 	"httpfromtcp/internal/request"
 	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/router"
 	"httpfromtcp/internal/server"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
-	"strings"
 	"syscall"
+	"time"
 )
 
 func getPort() uint16 {
@@ -33,6 +39,9 @@ func getPort() uint16 {
 
 var port = getPort()
 
+// shutdownTimeout is how long in-flight requests get to finish on SIGTERM.
+const shutdownTimeout = 10 * time.Second
+
 // @title           HTTP From TCP API
 // @version         1.0
 // @description     API para manejo de peticiones HTTP personalizadas
@@ -43,114 +52,165 @@ func main() {
 	// Inicializar la documentación Swagger
 	docs.SwaggerInfo.Host = fmt.Sprintf("localhost:%d", port)
 
-	s, err := server.Serve(port, func(w *response.Writer, req *request.Request) {
-		body := respond200()
-		h := response.GetDefaultHeaders(0)
-		status := response.StatusOK
-		endpoint := req.RequestLine.RequestTarget
-		if endpoint == "/yourproblem" {
-			status = response.StatusBadRequest
-			body = respond400()
-		} else if endpoint == "/myproblem" {
-			status = response.StatusInternalServerError
-			body = respond500()
-		} else if strings.HasPrefix(endpoint, "/httpbin/") {
-			res, err := http.Get("https://httpbin.org/" + endpoint[len("/httpbin/"):])
-			if err != nil {
-				body = respond500()
-				status = response.StatusInternalServerError
-			} else {
-				w.WriteStatusLine(response.StatusOK)
-				h.Delete("Content-length")
-				h.Set("Transfer-Encoding", "chunked")
-				h.Replace("Content-Type", "text/plain")
-				h.Set("Trailer", "X-Content-SHA256")
-				h.Set("Trailer", "X-Content-Length")
-				w.WriteHeaders(h)
-
-				fullBody := []byte{}
-				for {
-					data := make([]byte, 32)
-					n, err := res.Body.Read(data)
-					if err != nil {
-						break
-					}
-					fullBody = append(fullBody, data[:n]...)
-					w.WriteBody(fmt.Appendf(nil, "%x\r\n", n))
-					w.WriteBody(data[:n])
-					w.WriteBody([]byte("\r\n"))
-				}
-				w.WriteBody([]byte("0\r\n"))
-				trailers := headers.NewHeaders()
-				sha := sha256.Sum256(fullBody)
-				trailers.Set("X-Content-SHA256", toStr(sha[:]))
-				trailers.Set("X-Content-Length", strconv.Itoa(len(fullBody)))
-				w.WriteHeaders(trailers)
-				return
-			}
-		} else if endpoint == "/video" {
-			f, err := os.ReadFile("assets/vim.mp4")
-			if err != nil {
-				body = respond500()
-				status = response.StatusInternalServerError
-				return
-			}
-			h.Replace("Content-type", "video/mp4")
-			h.Replace("Content-length", strconv.Itoa(len(f)))
-			w.WriteStatusLine(status)
-			w.WriteHeaders(h)
-			w.WriteBody(f)
-			return
-		} else if endpoint == "/json" {
-			body = respondJSON()
-			h.Replace("Content-type", "application/json")
-			h.Replace("Content-length", strconv.Itoa(len(body)))
-			w.WriteStatusLine(status)
-			w.WriteHeaders(h)
-			w.WriteBody(body)
-			return
-		} else if endpoint == "/swagger" || endpoint == "/swagger/index.html" || endpoint == "/"{
-			// Servir la página HTML de Swagger UI
-			body = respondSwagger()
-			h.Replace("Content-type", "text/html")
-			h.Replace("Content-length", strconv.Itoa(len(body)))
-			w.WriteStatusLine(status)
-			w.WriteHeaders(h)
-			w.WriteBody(body)
-			return
-		} else if endpoint == "/swagger/doc.json" {
-			body = []byte(docs.SwaggerInfo.ReadDoc())
-			h.Replace("Content-type", "application/json")
-			h.Replace("Content-length", strconv.Itoa(len(body)))
-			w.WriteStatusLine(status)
-			w.WriteHeaders(h)
-			w.WriteBody(body)
-			return
-		}
-		h.Replace("Content-length", strconv.Itoa(len(body)))
-		h.Replace("Content-type", "text/html")
+	rt := router.New()
+	rt.Get("/", handleSwagger)
+	rt.Get("/swagger", handleSwagger)
+	rt.Get("/swagger/index.html", handleSwagger)
+	rt.Get("/swagger/doc.json", handleSwaggerDoc)
+	rt.Get("/yourproblem", server.HandleErrors(handleYourProblem))
+	rt.Get("/myproblem", server.HandleErrors(handleMyProblem))
+	rt.Get("/httpbin/{path...}", server.HandleErrors(handleHttpbin))
+	rt.Get("/video", server.HandleErrors(handleVideo))
+	rt.Get("/json", server.HandleErrors(handleJSON))
+	rt.NotFound = server.HandleErrors(handleDefault)
 
-		w.WriteStatusLine(status)
-		w.WriteHeaders(h)
-		w.WriteBody(body)
-	})
-	if err != nil {
-		log.Fatalf("Error starting server: %v", err)
+	opts := []server.Option{
+		server.WithAddr(fmt.Sprintf(":%d", port)),
+		server.WithHandler(rt.ServeRequest),
+		server.WithMiddleware(
+			middleware.Logger(log.Default()),
+			middleware.RequestID(),
+		),
+	}
+	// serve HTTPS when given a certificate; it is reloaded when renewed
+	if cert, key := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE"); cert != "" && key != "" {
+		opts = append(opts, server.WithCertificate(cert, key))
 	}
-	defer s.Close()
+	s := server.New(opts...)
+	go func() {
+		if err := s.ListenAndServe(); !errors.Is(err, server.ERROR_SERVER_CLOSED) {
+			log.Fatalf("Error starting server: %v", err)
+		}
+	}()
 	log.Println("Server started on port", port)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		log.Printf("Forced shutdown: %v", err)
+		return
+	}
 	log.Println("Server gracefully stopped")
 }
 
+func write(w *response.Writer, status response.StatusCode, contentType string, body []byte) {
+	h := response.GetDefaultHeaders(len(body))
+	h.Set("Content-type", contentType)
+	w.WriteStatusLine(status)
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
+
+// represent answers with page for browsers and with message as JSON for API
+// clients, whichever the Accept header prefers.
+func represent(w *response.Writer, req *request.Request, status response.StatusCode, page []byte, message string) error {
+	contentType, err := negotiate.ContentType(req, "text/html", "application/json")
+	if err != nil {
+		return err
+	}
+	body := page
+	if contentType == "application/json" {
+		if body, err = json.Marshal(response.JsonData{Message: message}); err != nil {
+			return err
+		}
+	}
+	h := response.GetDefaultHeaders(len(body))
+	h.Set("Content-Type", contentType)
+	h.Add("Vary", "Accept")
+	w.WriteStatusLine(status)
+	w.WriteHeaders(h)
+	_, err = w.WriteBody(body)
+	return err
+}
+
+func handleDefault(w *response.Writer, req *request.Request) error {
+	return represent(w, req, response.StatusOK, respond200(), "Success")
+}
+
+func handleYourProblem(w *response.Writer, req *request.Request) error {
+	return represent(w, req, response.StatusBadRequest, respond400(), "Bad Request")
+}
+
+func handleMyProblem(w *response.Writer, req *request.Request) error {
+	return represent(w, req, response.StatusInternalServerError, respond500(), "Internal Server Error")
+}
+
+func handleHttpbin(w *response.Writer, req *request.Request) error {
+	target := "https://httpbin.org/" + req.PathParam("path")
+	if req.URL.RawQuery != "" {
+		target += "?" + req.URL.RawQuery
+	}
+	res, err := http.Get(target)
+	if err != nil {
+		return &server.HandlerError{StatusCode: response.StatusBadGateway, Message: "httpbin.org is unreachable"}
+	}
+	defer res.Body.Close()
+	h := response.GetDefaultHeaders(0)
+	w.WriteStatusLine(response.StatusOK)
+	h.Delete("Content-length")
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Content-Type", "text/plain")
+	h.Add("Trailer", "X-Content-SHA256")
+	h.Add("Trailer", "X-Content-Length")
+	w.WriteHeaders(h)
+
+	fullBody := []byte{}
+	data := make([]byte, 32)
+	for {
+		n, err := res.Body.Read(data)
+		fullBody = append(fullBody, data[:n]...)
+		w.WriteChunkedBody(data[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// no last chunk, so the client sees the body as cut short
+			w.CloseConnection()
+			return err
+		}
+	}
+	w.WriteChunkedBodyDone()
+	trailers := headers.NewHeaders()
+	sha := sha256.Sum256(fullBody)
+	trailers.Set("X-Content-SHA256", toStr(sha[:]))
+	trailers.Set("X-Content-Length", strconv.Itoa(len(fullBody)))
+	return w.WriteTrailers(trailers)
+}
+
+func handleVideo(w *response.Writer, req *request.Request) error {
+	f, err := os.ReadFile("assets/vim.mp4")
+	if err != nil {
+		return &server.HandlerError{StatusCode: response.StatusInternalServerError, Message: "video unavailable"}
+	}
+	write(w, response.StatusOK, "video/mp4", f)
+	return nil
+}
+
+func handleJSON(w *response.Writer, req *request.Request) error {
+	if _, err := negotiate.ContentType(req, "application/json"); err != nil {
+		return err
+	}
+	write(w, response.StatusOK, "application/json", respondJSON())
+	return nil
+}
+
+// Servir la página HTML de Swagger UI
+func handleSwagger(w *response.Writer, req *request.Request) {
+	write(w, response.StatusOK, "text/html", respondSwagger())
+}
+
+func handleSwaggerDoc(w *response.Writer, req *request.Request) {
+	write(w, response.StatusOK, "application/json", []byte(docs.SwaggerInfo.ReadDoc()))
+}
+
 // Respond200 godoc
 // @Summary      Shows OK response
 // @Description  Returns 200 OK response
 // @Tags         responses
-// @Produce      text/html
+// @Produce      text/html,application/json
 // @Success      200  {string}  string  "OK"
 // @Router       / [get]
 func respond200() []byte {
@@ -169,7 +229,7 @@ func respond200() []byte {
 // @Summary      Shows bad request response
 // @Description  Returns 400 Bad Request response
 // @Tags         responses
-// @Produce      text/html
+// @Produce      text/html,application/json
 // @Success      400  {string}  string  "400 Bad Request"
 // @Router       /yourproblem [get]
 func respond400() []byte {
@@ -188,7 +248,7 @@ func respond400() []byte {
 // @Summary      Shows Internal Server Error
 // @Description  Returns 500 Internal Server Error
 // @Tags         responses
-// @Produce      text/html
+// @Produce      text/html,application/json
 // @Success      500  {string}  string  "500 Internal Server Error"
 // @Router       /myproblem [get]
 func respond500() []byte {
@@ -30,8 +30,12 @@ func main() {
 		r.Headers.ForEach(func(n, v string) {
 			fmt.Printf("- %s: %s\n", n, v)
 		})
+		body, err := r.ReadBody()
+		if err != nil {
+			log.Fatal("error ReadBody", "error", err)
+		}
 		fmt.Printf("Body:\n")
-		fmt.Printf("%s\n", r.Body)
+		fmt.Printf("%s\n", body)
 	}
 
 }
@@ -19,7 +19,8 @@ const docTemplate = `{
             "get": {
                 "description": "Returns 200 OK response",
                 "produces": [
-                    "text/html"
+                    "text/html",
+                    "application/json"
                 ],
                 "tags": [
                     "responses"
@@ -52,7 +53,8 @@ const docTemplate = `{
             "get": {
                 "description": "Returns 500 Internal Server Error",
                 "produces": [
-                    "text/html"
+                    "text/html",
+                    "application/json"
                 ],
                 "tags": [
                     "responses"
@@ -72,7 +74,8 @@ const docTemplate = `{
             "get": {
                 "description": "Returns 400 Bad Request response",
                 "produces": [
-                    "text/html"
+                    "text/html",
+                    "application/json"
                 ],
                 "tags": [
                     "responses"
@@ -0,0 +1,198 @@
+// Package cookie reads the Cookie request field and writes Set-Cookie
+// response fields (RFC 6265).
+package cookie
+
+import (
+	"fmt"
+	"httpfromtcp/internal/headers"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SameSiteLax    string = "Lax"
+	SameSiteStrict string = "Strict"
+	SameSiteNone   string = "None"
+)
+
+var ERROR_INVALID_NAME = fmt.Errorf("cookie name is not a token")
+var ERROR_INVALID_VALUE = fmt.Errorf("invalid character in cookie value")
+var ERROR_INVALID_DOMAIN = fmt.Errorf("invalid cookie Domain")
+var ERROR_INVALID_PATH = fmt.Errorf("invalid character in cookie Path")
+var ERROR_INVALID_SAMESITE = fmt.Errorf("SameSite must be Lax, Strict or None")
+var ERROR_NOT_SECURE = fmt.Errorf("cookie must be Secure")
+var ERROR_PREFIX = fmt.Errorf("cookie breaks the rules of its name prefix")
+
+// Cookie is a name-value pair and, when sent with Set-Cookie, the attributes
+// telling the client where to send it back and for how long. Cookies parsed
+// from a request only carry Name and Value.
+type Cookie struct {
+	Name  string
+	Value string
+	// Domain and Path limit which requests carry the cookie. An empty Domain
+	// means this host only.
+	Domain string
+	Path   string
+	// Expires is omitted when zero.
+	Expires time.Time
+	// MaxAge is the lifetime in seconds. Zero omits the attribute and a
+	// negative value deletes the cookie.
+	MaxAge   int
+	Secure   bool
+	HttpOnly bool
+	// SameSite is one of the SameSite* constants, or empty to omit it.
+	SameSite string
+	// Partitioned keys the cookie to the top-level site (CHIPS). It needs
+	// Secure.
+	Partitioned bool
+}
+
+// Error reports an invalid cookie. Err is one of the ERROR_* values above.
+type Error struct {
+	Err  error
+	Name string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("cookie %q: %v", e.Name, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// isCookieOctet reports whether ch may appear in a cookie-value: printable
+// US-ASCII except DQUOTE, comma, semicolon and backslash.
+func isCookieOctet(ch byte) bool {
+	return ch > ' ' && ch < 0x7f && ch != '"' && ch != ',' && ch != ';' && ch != '\\'
+}
+
+// validValue accepts a run of cookie-octets, optionally within DQUOTEs.
+func validValue(v string) bool {
+	if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		v = v[1 : len(v)-1]
+	}
+	for i := 0; i < len(v); i++ {
+		if !isCookieOctet(v[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// validDomain accepts a host name made of letters, digits and hyphens, with
+// an optional leading dot that clients ignore.
+func validDomain(d string) bool {
+	for _, label := range strings.Split(strings.TrimPrefix(d, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			ch := label[i]
+			if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func validPath(p string) bool {
+	for i := 0; i < len(p); i++ {
+		if p[i] < ' ' || p[i] == 0x7f || p[i] == ';' {
+			return false
+		}
+	}
+	return true
+}
+
+// Valid checks c against RFC 6265 section 4.1.1 and the rules clients apply
+// on top of it: SameSite=None and Partitioned need Secure, and the __Secure-
+// and __Host- name prefixes must hold.
+func (c *Cookie) Valid() error {
+	fail := func(err error) error {
+		return &Error{Err: err, Name: c.Name}
+	}
+	switch {
+	case !headers.IsToken(c.Name):
+		return fail(ERROR_INVALID_NAME)
+	case !validValue(c.Value):
+		return fail(ERROR_INVALID_VALUE)
+	case c.Domain != "" && !validDomain(c.Domain):
+		return fail(ERROR_INVALID_DOMAIN)
+	case !validPath(c.Path):
+		return fail(ERROR_INVALID_PATH)
+	}
+	switch c.SameSite {
+	case "", SameSiteLax, SameSiteStrict:
+	case SameSiteNone:
+		if !c.Secure {
+			return fail(ERROR_NOT_SECURE)
+		}
+	default:
+		return fail(ERROR_INVALID_SAMESITE)
+	}
+	if c.Partitioned && !c.Secure {
+		return fail(ERROR_NOT_SECURE)
+	}
+	if strings.HasPrefix(c.Name, "__Secure-") && !c.Secure {
+		return fail(ERROR_PREFIX)
+	}
+	if strings.HasPrefix(c.Name, "__Host-") && (!c.Secure || c.Domain != "" || c.Path != "/") {
+		return fail(ERROR_PREFIX)
+	}
+	return nil
+}
+
+// String serialises c as a Set-Cookie field value. It does not validate c;
+// call Valid first.
+func (c *Cookie) String() string {
+	b := strings.Builder{}
+	b.WriteString(c.Name + "=" + c.Value)
+	if c.Domain != "" {
+		b.WriteString("; Domain=" + strings.TrimPrefix(c.Domain, "."))
+	}
+	if c.Path != "" {
+		b.WriteString("; Path=" + c.Path)
+	}
+	if !c.Expires.IsZero() {
+		b.WriteString("; Expires=" + headers.FormatTime(c.Expires))
+	}
+	if c.MaxAge > 0 {
+		b.WriteString("; Max-Age=" + strconv.Itoa(c.MaxAge))
+	} else if c.MaxAge < 0 {
+		b.WriteString("; Max-Age=0")
+	}
+	if c.Secure {
+		b.WriteString("; Secure")
+	}
+	if c.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+	if c.SameSite != "" {
+		b.WriteString("; SameSite=" + c.SameSite)
+	}
+	if c.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+	return b.String()
+}
+
+// Parse reads the name-value pairs of a Cookie field value, such as
+// "session=abc; theme=dark". Pairs with an invalid name or value are
+// skipped, and DQUOTEs around a value are removed.
+func Parse(v string) []*Cookie {
+	cookies := []*Cookie{}
+	for _, pair := range strings.Split(v, ";") {
+		name, value, ok := strings.Cut(strings.Trim(pair, " \t"), "=")
+		if !ok || !headers.IsToken(name) || !validValue(value) {
+			continue
+		}
+		if len(value) >= 2 && value[0] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		cookies = append(cookies, &Cookie{Name: name, Value: value})
+	}
+	return cookies
+}
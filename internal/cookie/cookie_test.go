@@ -0,0 +1,82 @@
+package cookie
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCookieString(t *testing.T) {
+	// Test: Name and value only
+	c := &Cookie{Name: "theme", Value: "dark"}
+	require.NoError(t, c.Valid())
+	assert.Equal(t, "theme=dark", c.String())
+
+	// Test: Every attribute, in a fixed order
+	c = &Cookie{
+		Name:        "__Host-session",
+		Value:       `"abc"`,
+		Path:        "/",
+		Expires:     time.Date(2030, time.January, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600)),
+		MaxAge:      3600,
+		Secure:      true,
+		HttpOnly:    true,
+		SameSite:    SameSiteNone,
+		Partitioned: true,
+	}
+	require.NoError(t, c.Valid())
+	assert.Equal(t, `__Host-session="abc"; Path=/; Expires=Wed, 02 Jan 2030 02:04:05 GMT; Max-Age=3600; Secure; HttpOnly; SameSite=None; Partitioned`, c.String())
+
+	// Test: Deleting a cookie and dropping the leading dot of Domain
+	c = &Cookie{Name: "a", Domain: ".example.com", MaxAge: -1}
+	require.NoError(t, c.Valid())
+	assert.Equal(t, "a=; Domain=example.com; Max-Age=0", c.String())
+}
+
+func TestCookieValid(t *testing.T) {
+	cases := []struct {
+		name   string
+		cookie Cookie
+		err    error
+	}{
+		{"empty name", Cookie{Value: "v"}, ERROR_INVALID_NAME},
+		{"separator in name", Cookie{Name: "a=b"}, ERROR_INVALID_NAME},
+		{"space in value", Cookie{Name: "a", Value: "b c"}, ERROR_INVALID_VALUE},
+		{"semicolon in value", Cookie{Name: "a", Value: "b;c"}, ERROR_INVALID_VALUE},
+		{"comma in value", Cookie{Name: "a", Value: "b,c"}, ERROR_INVALID_VALUE},
+		{"unbalanced quote", Cookie{Name: "a", Value: `"b`}, ERROR_INVALID_VALUE},
+		{"non-ASCII value", Cookie{Name: "a", Value: "ñ"}, ERROR_INVALID_VALUE},
+		{"bad domain", Cookie{Name: "a", Domain: "exa mple.com"}, ERROR_INVALID_DOMAIN},
+		{"empty label", Cookie{Name: "a", Domain: "example..com"}, ERROR_INVALID_DOMAIN},
+		{"semicolon in path", Cookie{Name: "a", Path: "/;Secure"}, ERROR_INVALID_PATH},
+		{"unknown SameSite", Cookie{Name: "a", SameSite: "lax"}, ERROR_INVALID_SAMESITE},
+		{"SameSite=None without Secure", Cookie{Name: "a", SameSite: SameSiteNone}, ERROR_NOT_SECURE},
+		{"Partitioned without Secure", Cookie{Name: "a", Partitioned: true}, ERROR_NOT_SECURE},
+		{"__Secure- without Secure", Cookie{Name: "__Secure-a"}, ERROR_PREFIX},
+		{"__Host- with Domain", Cookie{Name: "__Host-a", Secure: true, Path: "/", Domain: "example.com"}, ERROR_PREFIX},
+		{"__Host- without Path=/", Cookie{Name: "__Host-a", Secure: true}, ERROR_PREFIX},
+	}
+	for _, c := range cases {
+		err := c.cookie.Valid()
+		assert.ErrorIs(t, err, c.err, c.name)
+		var cerr *Error
+		if assert.ErrorAs(t, err, &cerr, c.name) {
+			assert.Equal(t, c.cookie.Name, cerr.Name)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	// Test: Pairs in order, quotes removed, bad pairs skipped
+	cookies := Parse(`session=abc; theme="dark";novalue; bad name=1; x=a b;empty=; dup=1; dup=2`)
+	got := [][2]string{}
+	for _, c := range cookies {
+		got = append(got, [2]string{c.Name, c.Value})
+	}
+	assert.Equal(t, [][2]string{{"session", "abc"}, {"theme", "dark"}, {"empty", ""}, {"dup", "1"}, {"dup", "2"}}, got)
+
+	// Test: Empty field
+	assert.Empty(t, Parse(""))
+}
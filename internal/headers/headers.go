@@ -3,13 +3,56 @@ package headers
 import (
 	"bytes"
 	"fmt"
+	"slices"
 	"strings"
 )
 
-type Headers map[string]string
+// Headers is an ordered list of fields. Names keep the spelling they were
+// added with and are matched case-insensitively; a name may repeat.
+type Headers struct {
+	fields []field
+}
+
+type field struct {
+	name  string
+	value string
+}
 
 var rnSep = []byte("\r\n")
 
+// ERROR_BARE_LF reports a CR or LF not part of a CRLF line ending, which
+// some parsers treat as a line break and others do not (RFC 9112 section 2.2).
+var ERROR_BARE_LF = fmt.Errorf("bare CR or LF in message")
+var ERROR_WHITESPACE_BEFORE_COLON = fmt.Errorf("whitespace between field-name and colon")
+var ERROR_MALFORMED_FIELD_LINE = fmt.Errorf("field line without a colon")
+var ERROR_EMPTY_FIELD_NAME = fmt.Errorf("empty field-name")
+var ERROR_INVALID_FIELD_NAME = fmt.Errorf("field-name is not a token")
+var ERROR_INVALID_FIELD_VALUE = fmt.Errorf("control character in field-value")
+var ERROR_OBS_FOLD = fmt.Errorf("obsolete line folding")
+var ERROR_LEADING_WHITESPACE = fmt.Errorf("whitespace before the first field line")
+
+// FieldError is returned by Parse for a field line breaking RFC 9110 or
+// RFC 9112. Err is one of the ERROR_* values above and tells which rule.
+type FieldError struct {
+	Err  error
+	Line string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%v: %q", e.Err, e.Line)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ParseOptions tunes Parse for peers that predate RFC 9112.
+type ParseOptions struct {
+	// UnfoldObsFold accepts obsolete line folding, replacing each fold with
+	// a space, instead of rejecting it (RFC 9112 section 5.2).
+	UnfoldObsFold bool
+}
+
 func isValidToken(token []byte) bool {
 	for _, ch := range token {
 		valid := false
@@ -27,58 +70,152 @@ func isValidToken(token []byte) bool {
 	return true
 }
 
-func NewHeaders() Headers {
-	return Headers{}
+// IsToken reports whether s is a non-empty RFC 9110 token, the grammar of
+// field names and methods.
+func IsToken(s string) bool {
+	return s != "" && isValidToken([]byte(s))
+}
+
+func NewHeaders() *Headers {
+	return &Headers{}
 }
 
-func (h Headers) Get(name string) (string, bool) {
-	str, found := h[strings.ToLower(name)]
-	return str, found
+func (h *Headers) index(name string) int {
+	for i, f := range h.fields {
+		if strings.EqualFold(f.name, name) {
+			return i
+		}
+	}
+	return -1
 }
 
-func (h Headers) Set(name, value string) {
-	name = strings.ToLower(name)
-	if v, ok := h[name]; ok {
-		h[name] = fmt.Sprintf("%s,%s", v, value)
-	} else {
-		h[name] = value
+// Get returns the values of name joined by commas, as RFC 9110 section 5.3
+// allows for list-based fields. Set-Cookie is not one of them; read it with
+// Values.
+func (h *Headers) Get(name string) (string, bool) {
+	values := h.Values(name)
+	if values == nil {
+		return "", false
 	}
+	return strings.Join(values, ","), true
 }
 
-func (h Headers) Replace(name, value string) {
-	name = strings.ToLower(name)
-	h[name] = value
+// Values returns every value of name in the order they were added.
+func (h *Headers) Values(name string) []string {
+	var values []string
+	for _, f := range h.fields {
+		if strings.EqualFold(f.name, name) {
+			values = append(values, f.value)
+		}
+	}
+	return values
 }
 
-func (h Headers) Delete(name string) {
-	name = strings.ToLower(name)
-	delete(h, name)
+// Add appends a field, keeping any existing ones with the same name.
+func (h *Headers) Add(name, value string) {
+	h.fields = append(h.fields, field{name: name, value: value})
 }
 
-func (h *Headers) ForEach(cb func(n, v string)) {
-	for n, v := range *h {
-		cb(n, v)
+// Set replaces every field named name with a single one holding value. It
+// takes the place and spelling of the first existing field, if any.
+func (h *Headers) Set(name, value string) {
+	i := h.index(name)
+	if i == -1 {
+		h.Add(name, value)
+		return
 	}
+	h.fields[i].value = value
+	h.dedupe(i)
 }
 
-func parseHeader(fieldLine []byte) (string, string, error) {
-	parts := bytes.SplitN(fieldLine, []byte(":"), 2)
-	if len(parts) != 2 {
-		return "", "", fmt.Errorf("Parsing invalid field-line")
+// dedupe drops the fields named like fields[i] other than fields[i] itself.
+func (h *Headers) dedupe(i int) {
+	kept := h.fields[:0]
+	for j, f := range h.fields {
+		if j == i || !strings.EqualFold(f.name, h.fields[i].name) {
+			kept = append(kept, f)
+		}
 	}
-	name := parts[0]
-	value := bytes.TrimSpace(parts[1])
+	h.fields = kept
+}
+
+// Replace is the former name of Set.
+//
+// Deprecated: use Set.
+func (h *Headers) Replace(name, value string) {
+	h.Set(name, value)
+}
+
+func (h *Headers) Delete(name string) {
+	h.fields = slices.DeleteFunc(h.fields, func(f field) bool {
+		return strings.EqualFold(f.name, name)
+	})
+}
+
+// Len returns the number of fields, counting repeated names once per field.
+func (h *Headers) Len() int {
+	return len(h.fields)
+}
 
-	if bytes.HasSuffix(name, []byte(" ")) {
-		return "", "", fmt.Errorf("Invalid field-name containing trailing whitespaces")
+// ForEach calls cb once per field, in order, with the name as it was added.
+func (h *Headers) ForEach(cb func(n, v string)) {
+	for _, f := range h.fields {
+		cb(f.name, f.value)
 	}
+}
+
+// isValidValue reports whether v only holds field-vchars, obs-text, SP and
+// HTAB (RFC 9110 section 5.5).
+func isValidValue(v []byte) bool {
+	for _, ch := range v {
+		if ch < ' ' && ch != '\t' || ch == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// trimOWS strips optional whitespace, which is only SP and HTAB.
+func trimOWS(b []byte) []byte {
+	return bytes.Trim(b, " \t")
+}
 
+func parseHeader(fieldLine []byte) (string, string, error) {
+	fail := func(err error) (string, string, error) {
+		return "", "", &FieldError{Err: err, Line: string(fieldLine)}
+	}
+	if bytes.ContainsAny(fieldLine, "\r\n") {
+		return fail(ERROR_BARE_LF)
+	}
+	name, value, ok := bytes.Cut(fieldLine, []byte(":"))
+	if !ok {
+		return fail(ERROR_MALFORMED_FIELD_LINE)
+	}
+	// RFC 9112 section 5.1
+	if bytes.HasSuffix(name, []byte(" ")) || bytes.HasSuffix(name, []byte("\t")) {
+		return fail(ERROR_WHITESPACE_BEFORE_COLON)
+	}
+	if len(name) == 0 {
+		return fail(ERROR_EMPTY_FIELD_NAME)
+	}
+	if !isValidToken(name) {
+		return fail(ERROR_INVALID_FIELD_NAME)
+	}
+	value = trimOWS(value)
+	if !isValidValue(value) {
+		return fail(ERROR_INVALID_FIELD_VALUE)
+	}
 	return string(name), string(value), nil
+}
 
+// Parse adds the field lines at the start of data, rejecting obsolete line
+// folding. It returns how many bytes it consumed and whether it reached the
+// empty line ending the section.
+func (h *Headers) Parse(data []byte) (int, bool, error) {
+	return h.ParseWithOptions(data, ParseOptions{})
 }
 
-func (h Headers) Parse(data []byte) (int, bool, error) {
-	// Set-Person: lane-loves-go, prime-loves-zig, tj-loves-ocaml
+func (h *Headers) ParseWithOptions(data []byte, opts ParseOptions) (int, bool, error) {
 	read := 0
 	done := false
 	for {
@@ -92,16 +229,44 @@ func (h Headers) Parse(data []byte) (int, bool, error) {
 			read += len(rnSep)
 			break
 		}
-		end := read + idx
-		name, value, err := parseHeader(data[read:end])
-		if err != nil {
-			return 0, false, err
-		}
-		if !isValidToken([]byte(name)) {
-			return 0, false, fmt.Errorf("Header not valid as token %s", name)
+		line := data[read : read+idx]
+		if line[0] == ' ' || line[0] == '\t' {
+			if err := h.unfold(line, opts); err != nil {
+				return 0, false, err
+			}
+		} else {
+			name, value, err := parseHeader(line)
+			if err != nil {
+				return 0, false, err
+			}
+			h.Add(name, value)
 		}
 		read += idx + len(rnSep)
-		h.Set(name, value)
 	}
 	return read, done, nil
 }
+
+// unfold appends an obs-fold continuation line to the previous field.
+func (h *Headers) unfold(line []byte, opts ParseOptions) error {
+	if len(h.fields) == 0 {
+		// RFC 9112 section 2.2
+		return &FieldError{Err: ERROR_LEADING_WHITESPACE, Line: string(line)}
+	}
+	if !opts.UnfoldObsFold {
+		return &FieldError{Err: ERROR_OBS_FOLD, Line: string(line)}
+	}
+	if bytes.ContainsAny(line, "\r\n") {
+		return &FieldError{Err: ERROR_BARE_LF, Line: string(line)}
+	}
+	value := trimOWS(line)
+	if !isValidValue(value) {
+		return &FieldError{Err: ERROR_INVALID_FIELD_VALUE, Line: string(line)}
+	}
+	last := &h.fields[len(h.fields)-1]
+	if last.value == "" {
+		last.value = string(value)
+	} else if len(value) > 0 {
+		last.value += " " + string(value)
+	}
+	return nil
+}
@@ -1,7 +1,13 @@
 package headers
 
 import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -65,6 +71,16 @@ func TestHeadersParse(t *testing.T) {
 	assert.Equal(t, 0, n)
 	assert.False(t, done)
 
+	// Test: Whitespace before the colon
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte("Host\t: localhost:42069\r\n\r\n"))
+	require.ErrorIs(t, err, ERROR_WHITESPACE_BEFORE_COLON)
+
+	// Test: Bare LF inside a field line
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte("Host: localhost\nX-Evil: 1\r\n\r\n"))
+	require.ErrorIs(t, err, ERROR_BARE_LF)
+
 	//Test: 2 or more values per header name
 	headers = NewHeaders()
 	data = []byte("Host:localhost:42069\r\nHost:Google.com\r\n\r\n")
@@ -77,3 +93,257 @@ func TestHeadersParse(t *testing.T) {
 	assert.Equal(t, len(data), n)
 	assert.True(t, done)
 }
+
+func TestHeadersValidation(t *testing.T) {
+	// Test: Each violation has its own error
+	tests := map[string]error{
+		"Host localhost\r\n\r\n": ERROR_MALFORMED_FIELD_LINE,
+		": value\r\n\r\n":        ERROR_EMPTY_FIELD_NAME,
+		" Host: x\r\n\r\n":       ERROR_LEADING_WHITESPACE,
+		"Ho/st: x\r\n\r\n":       ERROR_INVALID_FIELD_NAME,
+		"Host: x\x00y\r\n\r\n":   ERROR_INVALID_FIELD_VALUE,
+		"Host: x\r\n\ty\r\n\r\n": ERROR_OBS_FOLD,
+		"Host: x\ry\r\n\r\n":     ERROR_BARE_LF,
+		"Host : x\r\n\r\n":       ERROR_WHITESPACE_BEFORE_COLON,
+	}
+	for data, want := range tests {
+		_, _, err := NewHeaders().Parse([]byte(data))
+		require.ErrorIs(t, err, want, data)
+		var fieldErr *FieldError
+		require.ErrorAs(t, err, &fieldErr)
+		assert.NotEmpty(t, fieldErr.Line)
+	}
+
+	// Test: Obsolete line folding can be unfolded instead
+	h := NewHeaders()
+	data := []byte("X-Long: first\r\n   second\r\n\tthird\r\nX-Empty:\r\n next\r\n\r\n")
+	n, done, err := h.ParseWithOptions(data, ParseOptions{UnfoldObsFold: true})
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, len(data), n)
+	v, _ := h.Get("x-long")
+	assert.Equal(t, "first second third", v)
+	v, _ = h.Get("x-empty")
+	assert.Equal(t, "next", v)
+
+	// Test: Unfolding still validates the continuation
+	_, _, err = NewHeaders().ParseWithOptions([]byte("A: b\r\n c\x01\r\n\r\n"), ParseOptions{UnfoldObsFold: true})
+	require.ErrorIs(t, err, ERROR_INVALID_FIELD_VALUE)
+}
+
+func TestHeadersOrder(t *testing.T) {
+	h := NewHeaders()
+	h.Add("Content-Type", "text/html")
+	h.Add("Set-Cookie", "a=1; Path=/")
+	h.Add("X-Trace", "1")
+	h.Add("set-cookie", "b=2")
+	serialized := func() string {
+		out := ""
+		h.ForEach(func(n, v string) { out += n + ": " + v + "\n" })
+		return out
+	}
+
+	// Test: Fields keep insertion order, spelling and repeats
+	assert.Equal(t, "Content-Type: text/html\nSet-Cookie: a=1; Path=/\nX-Trace: 1\nset-cookie: b=2\n", serialized())
+	assert.Equal(t, []string{"a=1; Path=/", "b=2"}, h.Values("SET-COOKIE"))
+	assert.Nil(t, h.Values("missing"))
+	assert.Equal(t, 4, h.Len())
+
+	// Test: Get joins repeated values for legacy callers
+	v, ok := h.Get("Set-Cookie")
+	assert.True(t, ok)
+	assert.Equal(t, "a=1; Path=/,b=2", v)
+
+	// Test: Set replaces every field in place of the first one
+	h.Set("SET-COOKIE", "c=3")
+	assert.Equal(t, "Content-Type: text/html\nSet-Cookie: c=3\nX-Trace: 1\n", serialized())
+	h.Set("X-New", "yes")
+	h.Replace("x-trace", "2")
+	assert.Equal(t, "Content-Type: text/html\nSet-Cookie: c=3\nX-Trace: 2\nX-New: yes\n", serialized())
+
+	// Test: Delete removes every field with the name
+	h.Add("x-new", "again")
+	h.Delete("X-NEW")
+	_, ok = h.Get("x-new")
+	assert.False(t, ok)
+	assert.Equal(t, 3, h.Len())
+}
+
+func TestHeadersList(t *testing.T) {
+	h := NewHeaders()
+	h.Add("Connection", "keep-alive, Upgrade")
+	h.Add("connection", " ,close")
+	h.Add("If-Match", `"a,b", W/"c"`)
+
+	// Test: Lists span repeated fields and skip empty elements
+	assert.Equal(t, []string{"keep-alive", "Upgrade", "close"}, h.List("Connection"))
+	assert.True(t, h.HasToken("connection", "CLOSE"))
+	assert.False(t, h.HasToken("connection", "clos"))
+	assert.Empty(t, h.List("missing"))
+
+	// Test: Commas inside quoted strings do not split
+	assert.Equal(t, []string{`"a,b"`, `W/"c"`}, h.List("If-Match"))
+	assert.Equal(t, []string{`"a\",b"`, "c"}, SplitList(`"a\",b", c`))
+}
+
+func TestHeadersWeighted(t *testing.T) {
+	h := NewHeaders()
+	h.Add("Accept", "text/plain;q=0.5, application/json;q=0, text/html;level=1, */*;q=0.8")
+	h.Add("Accept", "image/png;q=2, text/csv;q=0.5")
+
+	// Test: Sorted by q, ties in sent order, q=0 last, bad q dropped
+	list := h.Weighted("accept")
+	values := []string{}
+	for _, w := range list {
+		values = append(values, w.Value)
+	}
+	assert.Equal(t, []string{"text/html", "*/*", "text/plain", "text/csv", "application/json"}, values)
+	assert.Equal(t, map[string]string{"level": "1"}, list[0].Params)
+	assert.Equal(t, 1.0, list[0].Q)
+	assert.Equal(t, 0.0, list[4].Q)
+	assert.Empty(t, list[1].Params)
+
+	// Test: qvalue grammar
+	for _, q := range []string{"0", "1", "0.", "0.001", "1.000"} {
+		_, ok := parseQ(q)
+		assert.True(t, ok, q)
+	}
+	for _, q := range []string{"", "2", "1.5", "0.0001", "-0", ".5", "1e0", "01"} {
+		_, ok := parseQ(q)
+		assert.False(t, ok, q)
+	}
+}
+
+func TestHeadersParams(t *testing.T) {
+	// Test: Quoted values are unescaped and names lowercased
+	value, params, err := ParseParams(`text/html; Charset=utf-8 ;title="a \"b\"; c"`)
+	require.NoError(t, err)
+	assert.Equal(t, "text/html", value)
+	assert.Equal(t, map[string]string{"charset": "utf-8", "title": `a "b"; c`}, params)
+
+	// Test: No parameters
+	value, params, err = ParseParams("text/plain")
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", value)
+	assert.Empty(t, params)
+
+	// Test: Malformed parameters
+	for _, v := range []string{"a; b", "a; =c", `a; b="c`, `a; b="c"d`, "a; b=c d", `a; b="\`} {
+		_, _, err := ParseParams(v)
+		assert.ErrorIs(t, err, ERROR_INVALID_PARAMETER, v)
+	}
+
+	// Test: Missing field
+	_, _, err = NewHeaders().Params("Content-Type")
+	assert.ErrorIs(t, err, ERROR_FIELD_NOT_FOUND)
+}
+
+func TestHeadersTime(t *testing.T) {
+	want := time.Date(1994, time.November, 6, 8, 49, 37, 0, time.UTC)
+
+	// Test: All three HTTP-date formats
+	for _, v := range []string{"Sun, 06 Nov 1994 08:49:37 GMT", "Sunday, 06-Nov-94 08:49:37 GMT", "Sun Nov  6 08:49:37 1994"} {
+		got, err := ParseTime(v)
+		require.NoError(t, err, v)
+		assert.True(t, want.Equal(got), v)
+	}
+	for _, v := range []string{"", "Sun, 06 Nov 1994 08:49:37 PST", "1994-11-06T08:49:37Z"} {
+		_, err := ParseTime(v)
+		assert.ErrorIs(t, err, ERROR_INVALID_DATE, v)
+	}
+
+	// Test: SetTime writes IMF-fixdate in GMT
+	h := NewHeaders()
+	h.SetTime("Last-Modified", want.In(time.FixedZone("CET", 3600)))
+	v, _ := h.Get("Last-Modified")
+	assert.Equal(t, "Sun, 06 Nov 1994 08:49:37 GMT", v)
+	got, err := h.Time("last-modified")
+	require.NoError(t, err)
+	assert.True(t, want.Equal(got))
+	_, err = h.Time("Date")
+	assert.ErrorIs(t, err, ERROR_FIELD_NOT_FOUND)
+}
+
+func TestHeadersInt(t *testing.T) {
+	h := NewHeaders()
+	h.Add("Content-Length", "0042")
+	h.Add("Max-Forwards", "1")
+	h.Add("Max-Forwards", "1")
+
+	// Test: Digits only
+	n, err := h.Int("content-length")
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), n)
+	n, err = ParseInt("9223372036854775807")
+	require.NoError(t, err)
+	assert.Equal(t, int64(math.MaxInt64), n)
+
+	// Test: Leading zeros do not count towards overflow
+	n, err = ParseInt("0000000000000000005")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+
+	// Test: Signs, spaces, lists and overflow are rejected
+	for _, v := range []string{"", "-1", "+1", " 1", "1 ", "0x10", "1,1", "9223372036854775808", "99999999999999999999"} {
+		_, err := ParseInt(v)
+		assert.ErrorIs(t, err, ERROR_INVALID_INTEGER, v)
+	}
+	_, err = h.Int("Max-Forwards")
+	assert.ErrorIs(t, err, ERROR_INVALID_INTEGER)
+	_, err = h.Int("Age")
+	assert.ErrorIs(t, err, ERROR_FIELD_NOT_FOUND)
+}
+
+func FuzzHeadersParse(f *testing.F) {
+	// seed with the header sections of the requests cmd/tcplistener recorded
+	files, err := filepath.Glob("../../cmd/tcplistener/logs/*.http")
+	require.NoError(f, err)
+	for _, name := range files {
+		b, err := os.ReadFile(name)
+		require.NoError(f, err)
+		raw := strings.ReplaceAll(string(b), "read:", "")
+		if _, fields, ok := strings.Cut(raw, "\r\n"); ok {
+			f.Add([]byte(fields))
+		}
+	}
+	f.Add([]byte("Host: a\r\nHost: b\r\n\r\n"))
+	f.Add([]byte("X-Empty:\r\n\r\n"))
+	f.Add([]byte("Bad Name: v\r\n\r\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		h := NewHeaders()
+		n, done, err := h.Parse(data)
+		if err != nil {
+			if n != 0 || done {
+				t.Fatalf("error %v with n=%d done=%v", err, n, done)
+			}
+			return
+		}
+		if n > len(data) {
+			t.Fatalf("consumed %d of %d bytes", n, len(data))
+		}
+		if done && !bytes.HasSuffix(data[:n], []byte("\r\n\r\n")) && n != 2 {
+			t.Fatalf("done without an empty line: %q", data[:n])
+		}
+		h.ForEach(func(name, value string) {
+			if !IsToken(name) {
+				t.Fatalf("stored field name %q", name)
+			}
+			if strings.TrimSpace(value) != value {
+				t.Fatalf("value %q not trimmed", value)
+			}
+		})
+
+		// parsing the same bytes in two pieces gives the same fields
+		split := NewHeaders()
+		half := len(data[:n]) / 2
+		n1, _, err := split.Parse(data[:half])
+		if err != nil {
+			t.Fatalf("prefix failed: %v", err)
+		}
+		n2, _, err := split.Parse(data[n1:n])
+		if err != nil || n1+n2 != n {
+			t.Fatalf("split parse consumed %d+%d of %d: %v", n1, n2, n, err)
+		}
+		assert.Equal(t, h, split)
+	})
+}
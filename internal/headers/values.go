@@ -0,0 +1,258 @@
+package headers
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ERROR_FIELD_NOT_FOUND = fmt.Errorf("field not present")
+var ERROR_INVALID_INTEGER = fmt.Errorf("field is not a non-negative integer")
+var ERROR_INVALID_DATE = fmt.Errorf("field is not an HTTP-date")
+var ERROR_INVALID_PARAMETER = fmt.Errorf("malformed field parameter")
+
+// TimeFormat is the preferred HTTP-date format, IMF-fixdate (RFC 9110
+// section 5.6.7).
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// obsolete HTTP-date formats recipients must still accept
+const (
+	rfc850Format  = "Monday, 02-Jan-06 15:04:05 GMT"
+	asctimeFormat = "Mon Jan _2 15:04:05 2006"
+)
+
+// Weighted is one element of a list like Accept, with its q parameter
+// pulled out and the other parameters kept.
+type Weighted struct {
+	Value  string
+	Params map[string]string
+	Q      float64
+}
+
+// SplitList splits a comma-separated list (RFC 9110 section 5.6.1), keeping
+// commas inside quoted strings and dropping empty elements.
+func SplitList(v string) []string {
+	elements := []string{}
+	start, quoted, escaped := 0, false, false
+	for i := 0; i < len(v); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && v[i] == '\\':
+			escaped = true
+		case v[i] == '"':
+			quoted = !quoted
+		case v[i] == ',' && !quoted:
+			elements = appendElement(elements, v[start:i])
+			start = i + 1
+		}
+	}
+	return appendElement(elements, v[start:])
+}
+
+func appendElement(elements []string, e string) []string {
+	if e = strings.Trim(e, " \t"); e != "" {
+		elements = append(elements, e)
+	}
+	return elements
+}
+
+// List returns the elements of every name field as one list.
+func (h *Headers) List(name string) []string {
+	elements := []string{}
+	for _, v := range h.Values(name) {
+		elements = append(elements, SplitList(v)...)
+	}
+	return elements
+}
+
+// HasToken reports whether the name list contains token, compared
+// case-insensitively, as for "Connection: close".
+func (h *Headers) HasToken(name, token string) bool {
+	return slices.ContainsFunc(h.List(name), func(e string) bool {
+		return strings.EqualFold(e, token)
+	})
+}
+
+// ParseParams splits "value; a=1; b=\"quoted\"" into the value and its
+// parameters. Parameter names are lowercased and quoted values unescaped.
+func ParseParams(v string) (string, map[string]string, error) {
+	value, rest, _ := strings.Cut(v, ";")
+	params := map[string]string{}
+	rest = strings.Trim(rest, " \t")
+	for rest != "" {
+		name, after, ok := strings.Cut(rest, "=")
+		name = strings.ToLower(strings.Trim(name, " \t"))
+		if !ok || !IsToken(name) {
+			return "", nil, ERROR_INVALID_PARAMETER
+		}
+		after = strings.TrimLeft(after, " \t")
+		var val string
+		if strings.HasPrefix(after, `"`) {
+			unquoted, n, err := unquote(after)
+			if err != nil {
+				return "", nil, err
+			}
+			val, after = unquoted, after[n:]
+		} else {
+			val, after, _ = strings.Cut(after, ";")
+			val = strings.Trim(val, " \t")
+			if !IsToken(val) {
+				return "", nil, ERROR_INVALID_PARAMETER
+			}
+			after = ";" + after
+		}
+		after = strings.TrimLeft(after, " \t")
+		if after != "" && after[0] != ';' {
+			return "", nil, ERROR_INVALID_PARAMETER
+		}
+		params[name] = val
+		rest = strings.Trim(strings.TrimPrefix(after, ";"), " \t")
+	}
+	return strings.Trim(value, " \t"), params, nil
+}
+
+// unquote reads the quoted-string at the start of s and returns its content
+// and how many bytes of s it spanned.
+func unquote(s string) (string, int, error) {
+	b := strings.Builder{}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", 0, ERROR_INVALID_PARAMETER
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return "", 0, ERROR_INVALID_PARAMETER
+}
+
+// Params parses the first name field as a parameterised value, such as
+// "text/html; charset=utf-8".
+func (h *Headers) Params(name string) (string, map[string]string, error) {
+	v, ok := h.Get(name)
+	if !ok {
+		return "", nil, ERROR_FIELD_NOT_FOUND
+	}
+	if values := h.Values(name); len(values) > 1 {
+		v = values[0]
+	}
+	return ParseParams(v)
+}
+
+// parseQ parses a qvalue: "0" or "1" with up to three decimals (RFC 9110
+// section 12.4.2).
+func parseQ(v string) (float64, bool) {
+	if len(v) == 0 || len(v) > 5 || (v[0] != '0' && v[0] != '1') {
+		return 0, false
+	}
+	if len(v) > 1 && v[1] != '.' {
+		return 0, false
+	}
+	q, err := strconv.ParseFloat(v, 64)
+	if err != nil || q > 1 || strings.ContainsAny(v, "eE+-") {
+		return 0, false
+	}
+	return q, true
+}
+
+// Weighted parses a q-weighted list such as Accept or Accept-Language and
+// sorts it by decreasing q, keeping the sent order among equals. Elements
+// with q=0, which mean "not acceptable", are kept at the end. Malformed
+// elements are skipped.
+func (h *Headers) Weighted(name string) []Weighted {
+	list := []Weighted{}
+	for _, e := range h.List(name) {
+		value, params, err := ParseParams(e)
+		if err != nil {
+			continue
+		}
+		w := Weighted{Value: value, Params: params, Q: 1}
+		if q, ok := params["q"]; ok {
+			if w.Q, ok = parseQ(q); !ok {
+				continue
+			}
+			delete(params, "q")
+		}
+		list = append(list, w)
+	}
+	slices.SortStableFunc(list, func(a, b Weighted) int {
+		switch {
+		case a.Q > b.Q:
+			return -1
+		case a.Q < b.Q:
+			return 1
+		}
+		return 0
+	})
+	return list
+}
+
+// ParseTime parses an HTTP-date in IMF-fixdate or one of the two obsolete
+// formats (RFC 9110 section 5.6.7).
+func ParseTime(v string) (time.Time, error) {
+	for _, layout := range []string{TimeFormat, rfc850Format, asctimeFormat} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, ERROR_INVALID_DATE
+}
+
+// FormatTime formats t as an IMF-fixdate.
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(TimeFormat)
+}
+
+// Time parses the name field as an HTTP-date.
+func (h *Headers) Time(name string) (time.Time, error) {
+	v, ok := h.Get(name)
+	if !ok {
+		return time.Time{}, ERROR_FIELD_NOT_FOUND
+	}
+	return ParseTime(v)
+}
+
+// SetTime sets the name field to t as an IMF-fixdate.
+func (h *Headers) SetTime(name string, t time.Time) {
+	h.Set(name, FormatTime(t))
+}
+
+// ParseInt parses a non-negative decimal integer made of digits only, as
+// Content-Length and Max-Forwards are. Signs, spaces, lists and values that
+// overflow are rejected.
+func ParseInt(v string) (int64, error) {
+	if v == "" {
+		return 0, ERROR_INVALID_INTEGER
+	}
+	n := int64(0)
+	for _, ch := range []byte(v) {
+		if ch < '0' || ch > '9' {
+			return 0, ERROR_INVALID_INTEGER
+		}
+		d := int64(ch - '0')
+		// leading zeros are fine, only the value may not overflow
+		if n > (math.MaxInt64-d)/10 {
+			return 0, ERROR_INVALID_INTEGER
+		}
+		n = n*10 + d
+	}
+	return n, nil
+}
+
+// Int parses the name field with ParseInt. Repeated fields are joined first,
+// so they fail unless there is a single one.
+func (h *Headers) Int(name string) (int64, error) {
+	v, ok := h.Get(name)
+	if !ok {
+		return 0, ERROR_FIELD_NOT_FOUND
+	}
+	return ParseInt(v)
+}
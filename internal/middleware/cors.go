@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type CORSOptions struct {
+	// AllowedOrigins lists the origins allowed to call the API; "*" allows any.
+	AllowedOrigins []string
+	// AllowedMethods defaults to GET, HEAD and POST.
+	AllowedMethods []string
+	AllowedHeaders []string
+	ExposedHeaders []string
+	// AllowCredentials lets listed origins make credentialed requests.
+	// Origins only allowed through "*" never get credentials, or any site
+	// could act with the user's cookies.
+	AllowCredentials bool
+	// MaxAge is how many seconds browsers may cache a preflight answer.
+	MaxAge int
+}
+
+// CORS implements the Fetch standard's CORS protocol: it answers preflight
+// requests itself and adds the Access-Control-* fields to other responses
+// for allowed origins.
+func CORS(opts CORSOptions) server.Middleware {
+	if len(opts.AllowedMethods) == 0 {
+		opts.AllowedMethods = []string{"GET", "HEAD", "POST"}
+	}
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			origin, ok := req.Headers.Get("Origin")
+			listed := ok && opts.listsOrigin(origin)
+			wildcard := slices.Contains(opts.AllowedOrigins, "*")
+			if !listed && !(ok && wildcard) {
+				// keep caches from serving this answer to an allowed origin
+				if !opts.anyOrigin() {
+					w.OnHeaders(func(h *headers.Headers) {
+						h.Add("Vary", "Origin")
+					})
+				}
+				next(w, req)
+				return
+			}
+			allowOrigin, credentials := origin, opts.AllowCredentials
+			if !listed {
+				allowOrigin, credentials = "*", false
+			}
+			common := func(h *headers.Headers) {
+				h.Set("Access-Control-Allow-Origin", allowOrigin)
+				if allowOrigin != "*" {
+					h.Add("Vary", "Origin")
+				}
+				if credentials {
+					h.Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+
+			_, preflight := req.Headers.Get("Access-Control-Request-Method")
+			if req.RequestLine.Method == "OPTIONS" && preflight {
+				h := response.GetDefaultHeaders(0)
+				common(h)
+				h.Set("Access-Control-Allow-Methods", strings.Join(opts.AllowedMethods, ", "))
+				if len(opts.AllowedHeaders) > 0 {
+					h.Set("Access-Control-Allow-Headers", strings.Join(opts.AllowedHeaders, ", "))
+				} else if requested, ok := req.Headers.Get("Access-Control-Request-Headers"); ok {
+					h.Set("Access-Control-Allow-Headers", requested)
+				}
+				if opts.MaxAge > 0 {
+					h.Set("Access-Control-Max-Age", strconv.Itoa(opts.MaxAge))
+				}
+				w.WriteStatusLine(response.StatusNoContent)
+				w.WriteHeaders(h)
+				return
+			}
+
+			w.OnHeaders(func(h *headers.Headers) {
+				common(h)
+				if len(opts.ExposedHeaders) > 0 {
+					h.Set("Access-Control-Expose-Headers", strings.Join(opts.ExposedHeaders, ", "))
+				}
+			})
+			next(w, req)
+		}
+	}
+}
+
+func (opts CORSOptions) listsOrigin(origin string) bool {
+	for _, allowed := range opts.AllowedOrigins {
+		if allowed != "*" && strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyOrigin reports whether every origin gets the same "*" answer, so that
+// responses do not vary by Origin.
+func (opts CORSOptions) anyOrigin() bool {
+	for _, allowed := range opts.AllowedOrigins {
+		if allowed != "*" {
+			return false
+		}
+	}
+	return len(opts.AllowedOrigins) > 0
+}
@@ -0,0 +1,92 @@
+// Package middleware provides ready-made server.Middleware implementations.
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"log"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+// Logger logs one line per request with its method, target, status and
+// duration.
+func Logger(l *log.Logger) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			start := time.Now()
+			next(w, req)
+			l.Printf("%s %s %d %s", req.RequestLine.Method, req.RequestLine.RequestTarget, w.Status(), time.Since(start))
+		}
+	}
+}
+
+// Recover turns a panicking handler into a 500, provided the response has
+// not started yet, and logs the panic with its stack trace. Either way the
+// connection is closed, since a half-written response cannot be finished.
+// The server already recovers panics and reports them to Server.OnPanic;
+// use Recover only to log them somewhere else.
+func Recover(l *log.Logger) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			defer func() {
+				if rec := recover(); rec != nil {
+					l.Printf("panic serving %s %s: %v\n%s", req.RequestLine.Method, req.RequestLine.RequestTarget, rec, debug.Stack())
+					w.CloseConnection()
+					if w.State() == response.WriterStateStatusLine {
+						w.WriteStatusLine(response.StatusInternalServerError)
+						w.WriteHeaders(response.GetDefaultHeaders(0))
+					}
+				}
+			}()
+			next(w, req)
+		}
+	}
+}
+
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID makes sure every request carries an X-Request-ID header, keeping
+// the client's one or generating a random one, and echoes it on the response.
+func RequestID() server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			id, ok := req.Headers.Get(RequestIDHeader)
+			if !ok || id == "" {
+				id = newRequestID()
+				req.Headers.Set(RequestIDHeader, id)
+			}
+			w.OnHeaders(func(h *headers.Headers) {
+				h.Set(RequestIDHeader, id)
+			})
+			next(w, req)
+		}
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+const ResponseTimeHeader = "X-Response-Time"
+
+// Timing adds an X-Response-Time header with the microseconds elapsed until
+// the handler wrote its headers.
+func Timing() server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			start := time.Now()
+			w.OnHeaders(func(h *headers.Headers) {
+				h.Set(ResponseTimeHeader, strconv.FormatInt(time.Since(start).Microseconds(), 10)+"us")
+			})
+			next(w, req)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"bytes"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func run(t *testing.T, h server.Handler, raw string) string {
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	h(response.NewWriter(buf), req)
+	return buf.String()
+}
+
+func ok(w *response.Writer, req *request.Request) {
+	w.WriteStatusLine(response.StatusOK)
+	w.WriteHeaders(response.GetDefaultHeaders(0))
+}
+
+func TestLoggerAndRecover(t *testing.T) {
+	logs := &bytes.Buffer{}
+	l := log.New(logs, "", 0)
+	h := server.Chain(Logger(l), Recover(l))(func(w *response.Writer, req *request.Request) {
+		panic("boom")
+	})
+
+	// Test: Panics become a 500 and are logged with the request
+	res := run(t, h, "GET /explode HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 500 Internal Server Error\r\n"))
+	assert.Contains(t, logs.String(), "panic serving GET /explode: boom")
+	assert.Contains(t, logs.String(), "GET /explode 500 ")
+	assert.Contains(t, res, "Connection: close\r\n")
+
+	// Test: A panic mid-response closes the connection
+	h = Recover(l)(func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(10))
+		w.WriteBody([]byte("ab"))
+		panic("boom")
+	})
+	req, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	w := response.NewWriter(&bytes.Buffer{})
+	h(w, req)
+	assert.True(t, w.ClosesConnection())
+}
+
+func TestRequestIDAndTiming(t *testing.T) {
+	var seen string
+	h := server.Chain(RequestID(), Timing())(func(w *response.Writer, req *request.Request) {
+		seen, _ = req.Headers.Get(RequestIDHeader)
+		ok(w, req)
+	})
+
+	// Test: A request ID is generated and echoed
+	res := run(t, h, "GET / HTTP/1.1\r\n\r\n")
+	assert.Len(t, seen, 32)
+	assert.Contains(t, res, "X-Request-ID: "+seen+"\r\n")
+	assert.Contains(t, res, "X-Response-Time: ")
+
+	// Test: The client's request ID is kept
+	res = run(t, h, "GET / HTTP/1.1\r\nX-Request-ID: abc\r\n\r\n")
+	assert.Equal(t, "abc", seen)
+	assert.Contains(t, res, "X-Request-ID: abc\r\n")
+}
+
+func TestCORS(t *testing.T) {
+	h := CORS(CORSOptions{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []string{"GET", "PUT"},
+		MaxAge:         600,
+	})(ok)
+
+	// Test: Preflight is answered without reaching the handler
+	res := run(t, h, "OPTIONS /items HTTP/1.1\r\nOrigin: https://app.example.com\r\nAccess-Control-Request-Method: PUT\r\nAccess-Control-Request-Headers: content-type\r\n\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 204 No Content\r\n"))
+	assert.Contains(t, res, "Access-Control-Allow-Origin: https://app.example.com\r\n")
+	assert.Contains(t, res, "Access-Control-Allow-Methods: GET, PUT\r\n")
+	assert.Contains(t, res, "Access-Control-Allow-Headers: content-type\r\n")
+	assert.Contains(t, res, "Access-Control-Max-Age: 600\r\n")
+
+	// Test: Simple request from an allowed origin
+	res = run(t, h, "GET /items HTTP/1.1\r\nOrigin: https://app.example.com\r\n\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, res, "Access-Control-Allow-Origin: https://app.example.com\r\n")
+	assert.Contains(t, res, "Vary: Origin\r\n")
+
+	// Test: Other origins get no CORS headers
+	res = run(t, h, "GET /items HTTP/1.1\r\nOrigin: https://evil.example.com\r\n\r\n")
+	assert.NotContains(t, res, "Access-Control-Allow-Origin")
+	assert.Contains(t, res, "Vary: Origin\r\n")
+	res = run(t, h, "GET /items HTTP/1.1\r\n\r\n")
+	assert.Contains(t, res, "Vary: Origin\r\n")
+
+	// Test: Wildcard matches never get credentials
+	h = CORS(CORSOptions{
+		AllowedOrigins:   []string{"https://app.example.com", "*"},
+		AllowCredentials: true,
+	})(ok)
+	res = run(t, h, "GET /items HTTP/1.1\r\nOrigin: https://evil.example.com\r\n\r\n")
+	assert.Contains(t, res, "Access-Control-Allow-Origin: *\r\n")
+	assert.NotContains(t, res, "Access-Control-Allow-Credentials")
+	res = run(t, h, "GET /items HTTP/1.1\r\nOrigin: https://app.example.com\r\n\r\n")
+	assert.Contains(t, res, "Access-Control-Allow-Origin: https://app.example.com\r\n")
+	assert.Contains(t, res, "Access-Control-Allow-Credentials: true\r\n")
+
+	// Test: A wildcard-only policy does not vary by Origin
+	h = CORS(CORSOptions{AllowedOrigins: []string{"*"}})(ok)
+	res = run(t, h, "GET /items HTTP/1.1\r\nOrigin: https://any.example.com\r\n\r\n")
+	assert.Contains(t, res, "Access-Control-Allow-Origin: *\r\n")
+	assert.NotContains(t, res, "Vary")
+	res = run(t, h, "GET /items HTTP/1.1\r\n\r\n")
+	assert.NotContains(t, res, "Vary")
+}
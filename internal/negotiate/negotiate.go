@@ -0,0 +1,144 @@
+// Package negotiate picks which of the representations a handler can produce
+// to send, from the Accept, Accept-Encoding and Accept-Language fields of the
+// request (RFC 9110 section 12.5). Handlers that negotiate should add the
+// fields they looked at to Vary.
+package negotiate
+
+import (
+	"fmt"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"strings"
+)
+
+// ERROR_NOT_ACCEPTABLE is returned when the client refuses every offer.
+// HandleErrors answers it with 406 Not Acceptable.
+var ERROR_NOT_ACCEPTABLE = fmt.Errorf("no acceptable representation")
+
+// matcher reports whether the range r covers offer and, if so, how specific
+// the match is. The most specific matching range sets the offer's q.
+type matcher func(offer string, r headers.Weighted) (int, bool)
+
+// ContentType picks one of the offered media types, such as "text/html" or
+// "application/json; charset=utf-8". Without an Accept field every type is
+// acceptable and the first offer wins.
+func ContentType(req *request.Request, offers ...string) (string, error) {
+	ranges := req.Headers.Weighted("Accept")
+	if len(ranges) == 0 {
+		return first(offers)
+	}
+	return best(offers, ranges, matchMediaType, nil)
+}
+
+// Encoding picks one of the offered content codings, such as "gzip" or
+// "identity". Codings the client does not list are refused, except identity,
+// which is acceptable unless ruled out with "identity;q=0" or "*;q=0" (RFC
+// 9110 section 12.5.3). Any coding the client lists is preferred to it.
+func Encoding(req *request.Request, offers ...string) (string, error) {
+	if _, ok := req.Headers.Get("Accept-Encoding"); !ok {
+		return first(offers)
+	}
+	return best(offers, req.Headers.Weighted("Accept-Encoding"), matchEncoding, identity)
+}
+
+func identity(offer string) float64 {
+	if strings.EqualFold(offer, "identity") {
+		return 0.001
+	}
+	return 0
+}
+
+// Language picks one of the offered language tags, such as "en-US", using
+// basic filtering (RFC 4647 section 3.3.1): the range "en" covers "en-US".
+// Without an Accept-Language field the first offer wins.
+func Language(req *request.Request, offers ...string) (string, error) {
+	ranges := req.Headers.Weighted("Accept-Language")
+	if len(ranges) == 0 {
+		return first(offers)
+	}
+	return best(offers, ranges, matchLanguage, nil)
+}
+
+func first(offers []string) (string, error) {
+	if len(offers) == 0 {
+		return "", ERROR_NOT_ACCEPTABLE
+	}
+	return offers[0], nil
+}
+
+// best returns the offer with the highest q, the earliest one among equals.
+// Offers no range matches get q from unlisted, or are refused if it is nil.
+func best(offers []string, ranges []headers.Weighted, match matcher, unlisted func(string) float64) (string, error) {
+	chosen, chosenQ := "", 0.0
+	for _, offer := range offers {
+		q, specificity := 0.0, -1
+		if unlisted != nil {
+			q = unlisted(offer)
+		}
+		for _, r := range ranges {
+			if s, ok := match(offer, r); ok && s > specificity {
+				q, specificity = r.Q, s
+			}
+		}
+		if q > chosenQ {
+			chosen, chosenQ = offer, q
+		}
+	}
+	if chosen == "" {
+		return "", ERROR_NOT_ACCEPTABLE
+	}
+	return chosen, nil
+}
+
+// matchMediaType ranks "*/*" below "text/*" below "text/html", and ranges
+// with parameters above all of them (RFC 9110 section 12.5.1).
+func matchMediaType(offer string, r headers.Weighted) (int, bool) {
+	mediaType, params, err := headers.ParseParams(offer)
+	if err != nil {
+		return 0, false
+	}
+	offerType, offerSubtype, _ := strings.Cut(strings.ToLower(mediaType), "/")
+	rangeType, rangeSubtype, ok := strings.Cut(strings.ToLower(r.Value), "/")
+	if !ok {
+		return 0, false
+	}
+	specificity := 0
+	switch {
+	case rangeType == "*" && rangeSubtype == "*":
+	case rangeType == offerType && rangeSubtype == "*":
+		specificity = 1
+	case rangeType == offerType && rangeSubtype == offerSubtype:
+		specificity = 2
+	default:
+		return 0, false
+	}
+	for name, value := range r.Params {
+		if !strings.EqualFold(params[name], value) {
+			return 0, false
+		}
+		specificity++
+	}
+	return specificity, true
+}
+
+func matchEncoding(offer string, r headers.Weighted) (int, bool) {
+	switch {
+	case strings.EqualFold(r.Value, offer):
+		return 1, true
+	case r.Value == "*":
+		return 0, true
+	}
+	return 0, false
+}
+
+func matchLanguage(offer string, r headers.Weighted) (int, bool) {
+	switch {
+	case r.Value == "*":
+		return 0, true
+	case strings.EqualFold(r.Value, offer):
+		return len(r.Value), true
+	case len(offer) > len(r.Value) && offer[len(r.Value)] == '-' && strings.EqualFold(r.Value, offer[:len(r.Value)]):
+		return len(r.Value), true
+	}
+	return 0, false
+}
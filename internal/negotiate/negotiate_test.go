@@ -0,0 +1,116 @@
+package negotiate
+
+import (
+	"httpfromtcp/internal/request"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRequest(t *testing.T, fields ...string) *request.Request {
+	raw := "GET / HTTP/1.1\r\nHost: localhost\r\n"
+	for _, f := range fields {
+		if f != "" {
+			raw += f + "\r\n"
+		}
+	}
+	req, err := request.RequestFromReader(strings.NewReader(raw + "\r\n"))
+	require.NoError(t, err)
+	return req
+}
+
+func TestContentType(t *testing.T) {
+	offers := []string{"text/html", "application/json"}
+	cases := []struct {
+		accept string
+		want   string
+	}{
+		{"", "text/html"},
+		{"Accept: application/json", "application/json"},
+		{"Accept: text/html;q=0.5, application/*", "application/json"},
+		{"Accept: */*;q=0.1, application/json;q=0.2", "application/json"},
+		{"Accept: text/*, */*;q=0.9, text/html;q=0", "application/json"},
+		{"Accept: APPLICATION/JSON;q=0.9, text/html;q=0.9", "text/html"},
+		{"Accept: text/html;level=1, application/json;q=0.5", "application/json"},
+		{"Accept: image/png, text/html;q=0", ""},
+	}
+	for _, c := range cases {
+		got, err := ContentType(newRequest(t, c.accept), offers...)
+		if c.want == "" {
+			assert.ErrorIs(t, err, ERROR_NOT_ACCEPTABLE, c.accept)
+			continue
+		}
+		require.NoError(t, err, c.accept)
+		assert.Equal(t, c.want, got, c.accept)
+	}
+
+	// Test: Parameters in a range must match the offer
+	got, err := ContentType(newRequest(t, "Accept: text/html;charset=UTF-8, */*;q=0.1"), "text/html; charset=iso-8859-1", "text/html; charset=utf-8")
+	require.NoError(t, err)
+	assert.Equal(t, "text/html; charset=utf-8", got)
+
+	// Test: Nothing offered
+	_, err = ContentType(newRequest(t))
+	assert.ErrorIs(t, err, ERROR_NOT_ACCEPTABLE)
+}
+
+func TestEncoding(t *testing.T) {
+	offers := []string{"identity", "gzip", "br"}
+	cases := []struct {
+		accept string
+		want   string
+	}{
+		{"", "identity"},
+		{"Accept-Encoding: gzip", "gzip"},
+		{"Accept-Encoding: gzip;q=0.5, br", "br"},
+		{"Accept-Encoding: ", "identity"},
+		{"Accept-Encoding: deflate", "identity"},
+		{"Accept-Encoding: *", "identity"},
+		{"Accept-Encoding: identity;q=0, GZIP;q=0.1", "gzip"},
+		{"Accept-Encoding: *;q=0", ""},
+	}
+	for _, c := range cases {
+		got, err := Encoding(newRequest(t, c.accept), offers...)
+		if c.want == "" {
+			assert.ErrorIs(t, err, ERROR_NOT_ACCEPTABLE, c.accept)
+			continue
+		}
+		require.NoError(t, err, c.accept)
+		assert.Equal(t, c.want, got, c.accept)
+	}
+
+	// Test: Only identity is acceptable without being listed
+	for _, accept := range []string{"Accept-Encoding: gzip", "Accept-Encoding: identity;q=0, gzip", "Accept-Encoding: "} {
+		_, err := Encoding(newRequest(t, accept), "br")
+		assert.ErrorIs(t, err, ERROR_NOT_ACCEPTABLE, accept)
+	}
+	got, err := Encoding(newRequest(t, "Accept-Encoding: *"), "br")
+	require.NoError(t, err)
+	assert.Equal(t, "br", got)
+}
+
+func TestLanguage(t *testing.T) {
+	offers := []string{"en-US", "es", "pt-BR"}
+	cases := []struct {
+		accept string
+		want   string
+	}{
+		{"", "en-US"},
+		{"Accept-Language: es-ES, es;q=0.8", "es"},
+		{"Accept-Language: pt, en;q=0.5", "pt-BR"},
+		{"Accept-Language: en-us", "en-US"},
+		{"Accept-Language: fr, *;q=0.1, en;q=0", "es"},
+		{"Accept-Language: e, fr", ""},
+	}
+	for _, c := range cases {
+		got, err := Language(newRequest(t, c.accept), offers...)
+		if c.want == "" {
+			assert.ErrorIs(t, err, ERROR_NOT_ACCEPTABLE, c.accept)
+			continue
+		}
+		require.NoError(t, err, c.accept)
+		assert.Equal(t, c.want, got, c.accept)
+	}
+}
@@ -0,0 +1,119 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxDiscardBytes is how much of an unread body ReadRequest is willing to
+// throw away to reach the next request on the connection.
+const maxDiscardBytes = 256 * 1024
+
+var ERROR_BODY_CLOSED = fmt.Errorf("read on closed body")
+var ERROR_BODY_NOT_CONSUMED = fmt.Errorf("previous request body could not be discarded")
+
+// body feeds bytes buffered by the Reader, then the underlying source,
+// through the request state machine and hands out the decoded data.
+type body struct {
+	req         *Request
+	rd          *Reader
+	closed      bool
+	err         error
+	onFirstRead func() error
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, ERROR_BODY_CLOSED
+	}
+	if fn := b.onFirstRead; fn != nil {
+		b.onFirstRead = nil
+		if err := fn(); err != nil {
+			b.err = err
+			return 0, err
+		}
+	}
+	return b.read(p)
+}
+
+func (b *body) read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	n, err := b.decode(p)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+func (b *body) decode(p []byte) (int, error) {
+	r, rd := b.req, b.rd
+	for {
+		if len(r.pending) > 0 {
+			n := copy(p, r.pending)
+			r.pending = r.pending[n:]
+			return n, nil
+		}
+		if r.done() {
+			return 0, io.EOF
+		}
+		if rd.bufLen > 0 {
+			n, err := r.parse(rd.buf[:rd.bufLen])
+			if err != nil {
+				return 0, err
+			}
+			rd.consume(n)
+			if n > 0 {
+				continue
+			}
+		}
+		// Content-Length bodies skip the intermediate buffer entirely.
+		if r.state == StateBody && rd.bufLen == 0 {
+			n, err := rd.src.Read(p[:min(len(p), r.bodyLeft)])
+			r.bodyLeft -= n
+			if r.bodyLeft == 0 {
+				r.state = StateDone
+			}
+			if err == io.EOF && !r.done() {
+				err = io.ErrUnexpectedEOF
+			} else if err == io.EOF {
+				err = nil
+			}
+			return n, err
+		}
+		err := rd.fill()
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (b *body) Close() error {
+	b.closed = true
+	return nil
+}
+
+// discardBody skips what is left of the body, even if the handler closed it.
+// Any failure means the next request cannot be located on the connection.
+func (r *Request) discardBody() error {
+	p := make([]byte, 4096)
+	discarded := 0
+	for {
+		n, err := r.body.read(p)
+		discarded += n
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Join(ERROR_BODY_NOT_CONSUMED, err)
+		}
+		if discarded > maxDiscardBytes {
+			return ERROR_BODY_NOT_CONSUMED
+		}
+	}
+}
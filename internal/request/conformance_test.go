@@ -0,0 +1,125 @@
+package request
+
+import (
+	"httpfromtcp/internal/headers"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRFC9112Conformance walks the message grammar of RFC 9112, one row per
+// rule or edge of a rule. Rows with err set must fail with that error, rows
+// with a method must parse into the given request line, fields and body, and
+// the remaining ones must fail somehow.
+func TestRFC9112Conformance(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		err     error
+		method  string
+		target  string
+		version string
+		fields  map[string]string
+		body    string
+	}{
+		// 2.2 message parsing
+		{name: "2.2 leading empty lines are ignored", raw: "\r\n\r\nGET / HTTP/1.1\r\n\r\n", method: "GET", target: "/", version: "1.1"},
+		{name: "2.2 bare LF in request-line", raw: "GET / HTTP/1.1\n\r\n", err: headers.ERROR_BARE_LF},
+		{name: "2.2 bare CR in field line", raw: "GET / HTTP/1.1\r\nA: b\rc\r\n\r\n", err: headers.ERROR_BARE_LF},
+
+		// 3 request-line = method SP request-target SP HTTP-version
+		{name: "3 method is a token", raw: "GE(T / HTTP/1.1\r\n\r\n", err: ERROR_BAD_REQUEST_LINE},
+		{name: "3 empty method", raw: " / HTTP/1.1\r\n\r\n", err: ERROR_BAD_REQUEST_LINE},
+		{name: "3 methods are case-sensitive", raw: "get / HTTP/1.1\r\n\r\n", method: "get", target: "/", version: "1.1"},
+		{name: "3 extension method", raw: "PURGE /x HTTP/1.1\r\n\r\n", method: "PURGE", target: "/x", version: "1.1"},
+		{name: "3 single SP only", raw: "GET  / HTTP/1.1\r\n\r\n", err: ERROR_BAD_REQUEST_LINE},
+		{name: "3 HTAB is not a separator", raw: "GET\t/ HTTP/1.1\r\n\r\n", err: ERROR_BAD_REQUEST_LINE},
+		{name: "3 trailing SP", raw: "GET / HTTP/1.1 \r\n\r\n", err: ERROR_BAD_REQUEST_LINE},
+		{name: "3 missing version", raw: "GET /\r\n\r\n", err: ERROR_BAD_REQUEST_LINE},
+
+		// 2.3 HTTP-version = "HTTP" "/" DIGIT "." DIGIT
+		{name: "2.3 HTTP/1.0", raw: "GET / HTTP/1.0\r\n\r\n", method: "GET", target: "/", version: "1.0"},
+		{name: "2.3 name is case-sensitive", raw: "GET / Http/1.1\r\n\r\n", err: ERROR_INVALID_HTTP_VERSION},
+		{name: "2.3 one digit each", raw: "GET / HTTP/01.1\r\n\r\n", err: ERROR_INVALID_HTTP_VERSION},
+		{name: "2.3 minor required", raw: "GET / HTTP/1\r\n\r\n", err: ERROR_INVALID_HTTP_VERSION},
+		{name: "2.3 major version 2", raw: "GET / HTTP/2.0\r\n\r\n", err: ERROR_HTTP_VERSION_NOT_SUPPORTED},
+
+		// 3.2 request-target
+		{name: "3.2.1 origin-form", raw: "GET /a/b?c=d HTTP/1.1\r\n\r\n", method: "GET", target: "/a/b?c=d", version: "1.1"},
+		{name: "3.2.2 absolute-form", raw: "GET http://h/x HTTP/1.1\r\n\r\n", method: "GET", target: "http://h/x", version: "1.1"},
+		{name: "3.2.3 authority-form", raw: "CONNECT h:443 HTTP/1.1\r\n\r\n", method: "CONNECT", target: "h:443", version: "1.1"},
+		{name: "3.2.4 asterisk-form", raw: "OPTIONS * HTTP/1.1\r\n\r\n", method: "OPTIONS", target: "*", version: "1.1"},
+		{name: "3.2.4 asterisk-form only for OPTIONS", raw: "GET * HTTP/1.1\r\n\r\n", err: ERROR_BAD_REQUEST_TARGET},
+		{name: "3.2 relative target", raw: "GET a HTTP/1.1\r\n\r\n", err: ERROR_BAD_REQUEST_TARGET},
+		{name: "3.2.3 authority-form port is numeric", raw: "CONNECT 0:A HTTP/1.0\r\n\r\n", err: ERROR_BAD_REQUEST_TARGET},
+		{name: "3.2.3 authority-form host pct-encoding", raw: "CONNECT %:0 HTTP/1.0\r\n\r\n", err: ERROR_BAD_REQUEST_TARGET},
+		{name: "3.2.3 authority-form IP-literal", raw: "CONNECT [::1]:443 HTTP/1.1\r\n\r\n", method: "CONNECT", target: "[::1]:443", version: "1.1"},
+		{name: "3.2.2 absolute-form host is a reg-name", raw: "0 http://# HTTP/1.0\r\n\r\n", err: ERROR_BAD_REQUEST_TARGET},
+		{name: "3.2.2 absolute-form empty port", raw: "GET http://h:/x HTTP/1.1\r\n\r\n", method: "GET", target: "http://h:/x", version: "1.1"},
+
+		// 5 field-line = field-name ":" OWS field-value OWS
+		{name: "5 OWS around the value", raw: "GET / HTTP/1.1\r\nA: \t b \t\r\n\r\n", method: "GET", target: "/", version: "1.1", fields: map[string]string{"a": "b"}},
+		{name: "5 no OWS", raw: "GET / HTTP/1.1\r\nA:b\r\n\r\n", method: "GET", target: "/", version: "1.1", fields: map[string]string{"a": "b"}},
+		{name: "5 empty value", raw: "GET / HTTP/1.1\r\nA:\r\n\r\n", method: "GET", target: "/", version: "1.1", fields: map[string]string{"a": ""}},
+		{name: "5 names are case-insensitive", raw: "GET / HTTP/1.1\r\nX-A: 1\r\nx-a: 2\r\n\r\n", method: "GET", target: "/", version: "1.1", fields: map[string]string{"x-a": "1,2"}},
+		{name: "5.1 no whitespace before the colon", raw: "GET / HTTP/1.1\r\nA : b\r\n\r\n", err: headers.ERROR_WHITESPACE_BEFORE_COLON},
+		{name: "5.1 colon required", raw: "GET / HTTP/1.1\r\nA b\r\n\r\n", err: headers.ERROR_MALFORMED_FIELD_LINE},
+		{name: "5.1 name is a token", raw: "GET / HTTP/1.1\r\nA(b: c\r\n\r\n", err: headers.ERROR_INVALID_FIELD_NAME},
+		{name: "5.1 empty name", raw: "GET / HTTP/1.1\r\n: c\r\n\r\n", err: headers.ERROR_EMPTY_FIELD_NAME},
+		{name: "5.2 obs-fold", raw: "GET / HTTP/1.1\r\nA: b\r\n c\r\n\r\n", err: headers.ERROR_OBS_FOLD},
+		{name: "2.2 whitespace before the first field", raw: "GET / HTTP/1.1\r\n A: b\r\n\r\n", err: headers.ERROR_LEADING_WHITESPACE},
+		{name: "5.5 NUL in value", raw: "GET / HTTP/1.1\r\nA: b\x00c\r\n\r\n", err: headers.ERROR_INVALID_FIELD_VALUE},
+		{name: "5.5 control character in value", raw: "GET / HTTP/1.1\r\nA: \x1b[31m\r\n\r\n", err: headers.ERROR_INVALID_FIELD_VALUE},
+		{name: "5.5 DEL in value", raw: "GET / HTTP/1.1\r\nA: b\x7f\r\n\r\n", err: headers.ERROR_INVALID_FIELD_VALUE},
+		{name: "5.5 only SP and HTAB are OWS", raw: "GET / HTTP/1.1\r\nA: b\v\r\n\r\n", err: headers.ERROR_INVALID_FIELD_VALUE},
+		{name: "5.5 HTAB and obs-text in value", raw: "GET / HTTP/1.1\r\nA: b\tc\xe9\r\n\r\n", method: "GET", target: "/", version: "1.1", fields: map[string]string{"a": "b\tc\xe9"}},
+
+		// 6 message body
+		{name: "6.3 no framing means no body", raw: "POST / HTTP/1.1\r\n\r\n", method: "POST", target: "/", version: "1.1"},
+		{name: "6.3 Content-Length", raw: "POST / HTTP/1.1\r\nContent-Length: 3\r\n\r\nabc", method: "POST", target: "/", version: "1.1", body: "abc"},
+		{name: "6.3 Content-Length and Transfer-Encoding", raw: "POST / HTTP/1.1\r\nContent-Length: 3\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", err: ERROR_CONFLICTING_FRAMING},
+		{name: "6.3 invalid Content-Length", raw: "POST / HTTP/1.1\r\nContent-Length: 3a\r\n\r\nabc", err: ERROR_BAD_CONTENT_LENGTH},
+		{name: "6.3 chunked not final", raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked, gzip\r\n\r\n", err: ERROR_UNSUPPORTED_TRANSFER_CODING},
+		{name: "6.1 Transfer-Encoding in HTTP/1.0", raw: "POST / HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", err: ERROR_UNSUPPORTED_TRANSFER_CODING},
+
+		// 7.1 chunked transfer coding
+		{name: "7.1 hex chunk sizes", raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nA\r\n0123456789\r\na\r\n0123456789\r\n0\r\n\r\n", method: "POST", target: "/", version: "1.1", body: "01234567890123456789"},
+		{name: "7.1.1 chunk extensions are ignored", raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3;a=b;c\r\nabc\r\n0;x\r\n\r\n", method: "POST", target: "/", version: "1.1", body: "abc"},
+		{name: "7.1 chunk-data ends with CRLF", raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabcd\r\n0\r\n\r\n", err: ERROR_BAD_CHUNK_DATA},
+		{name: "7.1 chunk size is hex", raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nxyz\r\n", err: ERROR_BAD_CHUNK_SIZE},
+		{name: "7.1 negative chunk size", raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n-1\r\n", err: ERROR_BAD_CHUNK_SIZE},
+		{name: "7.1 signed chunk size", raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n+3\r\nabc\r\n0\r\n\r\n", err: ERROR_BAD_CHUNK_SIZE},
+		{name: "7.1 negative zero chunk size", raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n-0\r\n\r\n", err: ERROR_BAD_CHUNK_SIZE},
+		{name: "7.1 hex prefix in chunk size", raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n0x3\r\nabc\r\n0\r\n\r\n", err: ERROR_BAD_CHUNK_SIZE},
+		{name: "7.1 whitespace before chunk size", raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n 3\r\nabc\r\n0\r\n\r\n", err: ERROR_BAD_CHUNK_SIZE},
+		{name: "7.1.1 quoted and spaced chunk extensions", raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3 ; a = \"x\\\";y\" ;b\r\nabc\r\n0\r\n\r\n", method: "POST", target: "/", version: "1.1", body: "abc"},
+		{name: "7.1.1 bare LF in chunk extension", raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5;a\nb\r\nhello\r\n0\r\n\r\n", err: ERROR_BAD_CHUNK_SIZE},
+		{name: "7.1.1 control byte in chunk extension", raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5;\x00\r\nhello\r\n0\r\n\r\n", err: ERROR_BAD_CHUNK_SIZE},
+		{name: "7.1.1 chunk extension without a name", raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5;=x\r\nhello\r\n0\r\n\r\n", err: ERROR_BAD_CHUNK_SIZE},
+		{name: "7.1.1 unterminated quoted chunk extension", raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5;a=\"x\r\nhello\r\n0\r\n\r\n", err: ERROR_BAD_CHUNK_SIZE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, body, err := fuzzParse(tt.raw, 2)
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+				return
+			}
+			if tt.method == "" {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.method, r.RequestLine.Method)
+			assert.Equal(t, tt.target, r.RequestLine.RequestTarget)
+			assert.Equal(t, tt.version, r.RequestLine.HttpVersion)
+			assert.Equal(t, tt.body, body)
+			for name, value := range tt.fields {
+				got, ok := r.Headers.Get(name)
+				assert.True(t, ok, name)
+				assert.Equal(t, value, got, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package request
+
+import (
+	"fmt"
+	"httpfromtcp/internal/cookie"
+)
+
+var ERROR_NO_COOKIE = fmt.Errorf("named cookie not present")
+
+// Cookies returns the cookies the client sent, in the order it sent them.
+// Malformed pairs are skipped.
+func (r *Request) Cookies() []*cookie.Cookie {
+	cookies := []*cookie.Cookie{}
+	for _, v := range r.Headers.Values("cookie") {
+		cookies = append(cookies, cookie.Parse(v)...)
+	}
+	return cookies
+}
+
+// Cookie returns the first cookie called name, or ERROR_NO_COOKIE.
+func (r *Request) Cookie(name string) (*cookie.Cookie, error) {
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return nil, ERROR_NO_COOKIE
+}
@@ -0,0 +1,76 @@
+package request
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// compareWithNetHTTP parses data with both this package and net/http and
+// describes the first disagreement, or returns "". Being stricter than
+// net/http is fine; accepting what it rejects, or reading a request
+// differently, is not. Two differences are deliberate: net/http requires
+// Host on HTTP/1.1 requests and does not skip empty lines before the
+// request-line, which RFC 9112 section 2.2 recommends.
+func compareWithNetHTTP(data string) string {
+	ours, ourBody, ourErr := fuzzParse(data, len(data)+1)
+	if ourErr != nil {
+		return ""
+	}
+	trimmed := data
+	for strings.HasPrefix(trimmed, "\r\n") {
+		trimmed = trimmed[2:]
+	}
+	theirs, err := http.ReadRequest(bufio.NewReader(strings.NewReader(trimmed)))
+	if err != nil {
+		if strings.Contains(err.Error(), "missing required Host header") {
+			return ""
+		}
+		return fmt.Sprintf("accepted what net/http rejects (%v): %q", err, data)
+	}
+	theirBody, err := io.ReadAll(io.LimitReader(theirs.Body, 1<<16+1))
+	if err != nil {
+		return fmt.Sprintf("net/http fails reading a body we read (%v): %q", err, data)
+	}
+	switch {
+	case ours.RequestLine.Method != theirs.Method:
+		return fmt.Sprintf("method %q vs %q", ours.RequestLine.Method, theirs.Method)
+	case ours.RequestLine.RequestTarget != theirs.RequestURI:
+		return fmt.Sprintf("target %q vs %q", ours.RequestLine.RequestTarget, theirs.RequestURI)
+	case ours.RequestLine.HttpVersion != fmt.Sprintf("%d.%d", theirs.ProtoMajor, theirs.ProtoMinor):
+		return fmt.Sprintf("version %q vs %q", ours.RequestLine.HttpVersion, theirs.Proto)
+	case ourBody != string(theirBody):
+		return fmt.Sprintf("body %q vs %q in %q", ourBody, theirBody, data)
+	}
+	for name, values := range theirs.Header {
+		ourValue, ok := ours.Headers.Get(name)
+		if !ok || ourValue != strings.Join(values, ",") {
+			return fmt.Sprintf("header %s: %q vs %q", name, ourValue, values)
+		}
+	}
+	return ""
+}
+
+func TestDifferential(t *testing.T) {
+	// Test: Requests both parsers accept are read the same way
+	inputs := append(loadCaptures(t), fuzzSeeds...)
+	inputs = append(inputs,
+		"GET /a%20b?x=1&x=2 HTTP/1.1\r\nHost: x\r\nAccept: a\r\nAccept: b\r\n\r\n",
+		"POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 0\r\n\r\n",
+		"POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\nA\r\n0123456789\r\n0\r\n\r\n",
+		"GET / HTTP/1.1\r\nHost: x\r\nX-Spaces:   padded value \t\r\n\r\n",
+		"POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 5, 5\r\n\r\nhello",
+		"POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\nContent-Length: 6\r\n\r\nhello!",
+		"POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: gzip\r\n\r\n",
+		"GET / HTTP/1.1\r\nHost: x\r\n folded: value\r\n\r\n",
+		"GET / HTTP/1.1\r\nHost: x\r\nBad Name: v\r\n\r\n",
+	)
+	for _, data := range inputs {
+		if msg := compareWithNetHTTP(data); msg != "" {
+			t.Error(msg)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"strings"
+)
+
+// DefaultMaxFormBytes bounds urlencoded bodies read by ParseForm.
+const DefaultMaxFormBytes = 10 << 20
+
+// DefaultMaxMemory is the ParseMultipartForm threshold FormValue and
+// FormFile use.
+const DefaultMaxMemory = 32 << 20
+
+var ERROR_NOT_MULTIPART = fmt.Errorf("request Content-Type is not multipart/form-data")
+var ERROR_FORM_TOO_LARGE = fmt.Errorf("form body too large")
+var ERROR_MISSING_FILE = fmt.Errorf("no such file in multipart form")
+var ERROR_MALFORMED_FORM = fmt.Errorf("malformed form body")
+
+// ParseForm fills PostForm from an application/x-www-form-urlencoded body
+// sent with POST, PUT or PATCH, and Form with those values followed by the
+// query parameters. It consumes the body and is a no-op on later calls.
+func (r *Request) ParseForm() error {
+	if r.Form != nil {
+		return nil
+	}
+	r.PostForm = Query{}
+	var err error
+	if r.hasFormBody() {
+		if mediaType, _, _ := r.contentType(); mediaType == "application/x-www-form-urlencoded" {
+			err = r.parsePostForm()
+		}
+	}
+	r.Form = Query{}
+	for name, values := range r.PostForm {
+		r.Form[name] = append(r.Form[name], values...)
+	}
+	for name, values := range r.Query() {
+		r.Form[name] = append(r.Form[name], values...)
+	}
+	return err
+}
+
+func (r *Request) parsePostForm() error {
+	b, err := io.ReadAll(io.LimitReader(r.BodyReader, DefaultMaxFormBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(b) > DefaultMaxFormBytes {
+		return &LimitError{Err: ERROR_FORM_TOO_LARGE, Limit: DefaultMaxFormBytes}
+	}
+	values, err := url.ParseQuery(string(b))
+	r.PostForm = Query(values)
+	if err != nil {
+		return errors.Join(ERROR_MALFORMED_FORM, err)
+	}
+	return nil
+}
+
+// ParseMultipartForm parses a multipart/form-data body. Up to maxMemory bytes
+// of file parts are kept in memory, the rest is written to temporary files
+// the server removes once the handler returns. Text fields are added to Form
+// and PostForm. Later calls return the result of the first one.
+func (r *Request) ParseMultipartForm(maxMemory int64) error {
+	if !r.multipartParsed {
+		r.multipartParsed = true
+		r.multipartErr = r.parseMultipartForm(maxMemory)
+	}
+	return r.multipartErr
+}
+
+func (r *Request) parseMultipartForm(maxMemory int64) error {
+	// fill Form from the query and any urlencoded body even when this turns
+	// out not to be multipart, so FormValue works for every request
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	mediaType, params, err := r.contentType()
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return ERROR_NOT_MULTIPART
+	}
+	form, err := multipart.NewReader(r.BodyReader, params["boundary"]).ReadForm(maxMemory)
+	if err != nil {
+		if errors.Is(err, multipart.ErrMessageTooLarge) {
+			return errors.Join(ERROR_FORM_TOO_LARGE, err)
+		}
+		return errors.Join(ERROR_MALFORMED_FORM, err)
+	}
+	r.MultipartForm = form
+	for name, values := range form.Value {
+		r.PostForm[name] = append(r.PostForm[name], values...)
+		// body values come before query ones
+		r.Form[name] = append(values[:len(values):len(values)], r.Form[name]...)
+	}
+	return nil
+}
+
+// FormValue returns the first value for name from the body or the query,
+// parsing the form if needed. Errors are ignored.
+func (r *Request) FormValue(name string) string {
+	r.ParseMultipartForm(DefaultMaxMemory)
+	return r.Form.Get(name)
+}
+
+// FormFile returns the first file uploaded under name.
+func (r *Request) FormFile(name string) (multipart.File, *multipart.FileHeader, error) {
+	if err := r.ParseMultipartForm(DefaultMaxMemory); err != nil {
+		return nil, nil, err
+	}
+	files := r.MultipartForm.File[name]
+	if len(files) == 0 {
+		return nil, nil, ERROR_MISSING_FILE
+	}
+	f, err := files[0].Open()
+	return f, files[0], err
+}
+
+// RemoveForm deletes the temporary files ParseMultipartForm created.
+func (r *Request) RemoveForm() error {
+	if r.MultipartForm == nil {
+		return nil
+	}
+	return r.MultipartForm.RemoveAll()
+}
+
+func (r *Request) hasFormBody() bool {
+	switch r.RequestLine.Method {
+	case "POST", "PUT", "PATCH":
+		return true
+	}
+	return false
+}
+
+func (r *Request) contentType() (string, map[string]string, error) {
+	if _, ok := r.Headers.Get("content-type"); !ok {
+		return "", nil, nil
+	}
+	mediaType, params, err := r.Headers.Params("content-type")
+	return strings.ToLower(mediaType), params, err
+}
@@ -0,0 +1,71 @@
+package request
+
+import (
+	"fmt"
+	"httpfromtcp/internal/headers"
+	"math"
+	"strings"
+)
+
+var ERROR_BAD_CONTENT_LENGTH = fmt.Errorf("invalid Content-Length")
+var ERROR_CONFLICTING_FRAMING = fmt.Errorf("both Content-Length and Transfer-Encoding present")
+var ERROR_UNSUPPORTED_TRANSFER_CODING = fmt.Errorf("unsupported transfer coding")
+
+// FramingError reports a request whose body length cannot be determined
+// unambiguously (RFC 9112 section 6.3). Such a request could be read
+// differently by a proxy in front of the server, so it is always refused.
+type FramingError struct {
+	Err   error
+	Value string
+}
+
+func (e *FramingError) Error() string {
+	return fmt.Sprintf("%v: %q", e.Err, e.Value)
+}
+
+func (e *FramingError) Unwrap() error {
+	return e.Err
+}
+
+// parseContentLength accepts a single run of digits. Lists, even of equal
+// values, signs and surrounding junk are all rejected.
+func parseContentLength(v string) (int, error) {
+	n, err := headers.ParseInt(v)
+	if err != nil || n > math.MaxInt {
+		return 0, &FramingError{Err: ERROR_BAD_CONTENT_LENGTH, Value: v}
+	}
+	return int(n), nil
+}
+
+// setFraming picks the body state once the headers are parsed. Only the
+// chunked transfer coding is understood, and only on its own.
+func (r *Request) setFraming() error {
+	te, hasTE := r.Headers.Get("transfer-encoding")
+	cl, hasCL := r.Headers.Get("content-length")
+	switch {
+	case hasTE && hasCL:
+		return &FramingError{Err: ERROR_CONFLICTING_FRAMING, Value: te}
+	case hasTE:
+		// HTTP/1.0 has no transfer codings (RFC 9112 section 6.1)
+		if !strings.EqualFold(strings.TrimSpace(te), "chunked") || !r.RequestLine.ProtoAtLeast(1, 1) {
+			return &FramingError{Err: ERROR_UNSUPPORTED_TRANSFER_CODING, Value: te}
+		}
+		r.state = StateChunkSize
+	case hasCL:
+		n, err := parseContentLength(cl)
+		if err != nil {
+			return err
+		}
+		if r.opts.MaxBodyBytes > 0 && n > r.opts.MaxBodyBytes {
+			return &LimitError{Err: ERROR_BODY_TOO_LARGE, Limit: r.opts.MaxBodyBytes}
+		}
+		r.bodyLeft = n
+		r.state = StateBody
+		if n == 0 {
+			r.state = StateDone
+		}
+	default:
+		r.state = StateDone
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package request
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// loadCaptures returns the raw requests recorded by cmd/tcplistener, whose
+// log lines carry a "read:" prefix.
+func loadCaptures(tb testing.TB) []string {
+	files, err := filepath.Glob("../../cmd/tcplistener/logs/*.http")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	captures := []string{}
+	for _, name := range files {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		lines := strings.Split(string(b), "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimPrefix(line, "read:")
+		}
+		captures = append(captures, strings.Join(lines, "\n"))
+	}
+	return captures
+}
+
+var fuzzSeeds = []string{
+	"GET / HTTP/1.1\r\nHost: x\r\n\r\n",
+	"\r\n\r\nGET /a?b=c HTTP/1.0\r\nConnection: keep-alive\r\n\r\n",
+	"POST /up HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5;ext=1\r\nhello\r\n0\r\nX-Sum: 1\r\n\r\n",
+	"POST / HTTP/1.1\r\nContent-Length: 3\r\n\r\nabcGET / HTTP/1.1\r\n\r\n",
+	"OPTIONS * HTTP/1.1\r\n\r\n",
+	"CONNECT example.com:443 HTTP/1.1\r\n\r\n",
+	"GET http://example.com/%2e%2e/x HTTP/1.1\r\n\r\n",
+	"POST / HTTP/1.1\r\nContent-Length: 1\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+	"PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n",
+	"0 / HTTP/1.0\r\n0:\x1c\r\n\r\n",
+	"GET / HTTP/1.1\r\nA: b\r\n c\r\n\r\n",
+}
+
+// fuzzParse reads one request and its whole body, feeding data n bytes at a
+// time.
+func fuzzParse(data string, n int) (*Request, string, error) {
+	opts := ParseOptions{MaxHeaderBytes: 4096, MaxBodyBytes: 1 << 16}
+	r, err := RequestFromReaderWithOptions(&chunkReader{data: data, numBytesPerRead: n}, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	body, err := r.ReadBody()
+	return r, body, err
+}
+
+func FuzzRequestFromReader(f *testing.F) {
+	for _, seed := range append(loadCaptures(f), fuzzSeeds...) {
+		f.Add(seed, uint8(3))
+	}
+	f.Fuzz(func(t *testing.T, data string, step uint8) {
+		r, body, err := fuzzParse(data, len(data)+1)
+		if err != nil {
+			return
+		}
+		if !r.RequestLine.ProtoAtLeast(1, 0) || r.RequestLine.ProtoAtLeast(2, 0) {
+			t.Fatalf("accepted version %q", r.RequestLine.HttpVersion)
+		}
+		if len(body) > len(data) {
+			t.Fatalf("body longer than the input")
+		}
+
+		// the outcome must not depend on how the input is split into reads
+		r2, body2, err2 := fuzzParse(data, int(step%16)+1)
+		if err2 != nil {
+			t.Fatalf("whole read succeeded, split read failed: %v", err2)
+		}
+		if body != body2 || r.RequestLine != r2.RequestLine || !reflect.DeepEqual(r.URL, r2.URL) {
+			t.Fatalf("split read disagrees: %+v %q vs %+v %q", r.RequestLine, body, r2.RequestLine, body2)
+		}
+	})
+}
+
+func FuzzDifferential(f *testing.F) {
+	for _, seed := range append(loadCaptures(f), fuzzSeeds...) {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data string) {
+		if msg := compareWithNetHTTP(data); msg != "" {
+			t.Fatal(msg)
+		}
+	})
+}
+
+func TestCapturesParse(t *testing.T) {
+	// Test: Every recorded request parses, on any read size
+	captures := loadCaptures(t)
+	if len(captures) == 0 {
+		t.Fatal("no captures found")
+	}
+	for _, c := range captures {
+		for _, n := range []int{1, 7, len(c)} {
+			_, _, err := fuzzParse(c, n)
+			if err != nil {
+				t.Errorf("%q split by %d: %v", c, n, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package request
+
+import "fmt"
+
+const (
+	DefaultMaxRequestLineBytes = 8 * 1024
+	DefaultMaxHeaderBytes      = 64 * 1024
+	DefaultMaxHeaderCount      = 100
+	DefaultMaxBodyBytes        = 10 * 1024 * 1024
+
+	initialBufferSize = 1024
+	maxChunkSizeLine  = 4096
+)
+
+var ERROR_REQUEST_LINE_TOO_LONG = fmt.Errorf("request-line too long")
+var ERROR_HEADERS_TOO_LARGE = fmt.Errorf("header section too large")
+var ERROR_TOO_MANY_HEADERS = fmt.Errorf("too many header fields")
+var ERROR_BODY_TOO_LARGE = fmt.Errorf("request body too large")
+
+// ParseOptions bounds how much a single request may make the parser buffer
+// and how lenient it is with obsolete syntax. A zero limit falls back to the
+// matching Default* constant; a negative MaxBodyBytes disables the body
+// limit.
+type ParseOptions struct {
+	MaxRequestLineBytes int
+	MaxHeaderBytes      int
+	MaxHeaderCount      int
+	MaxBodyBytes        int
+	// UnfoldObsFold accepts header fields continued on the next line, which
+	// RFC 9112 deprecates, by joining the lines with a space.
+	UnfoldObsFold bool
+}
+
+// LimitError is returned when a request exceeds one of the ParseOptions.
+// Err is one of the ERROR_*_TOO_* sentinels, so callers can match it with
+// errors.Is.
+type LimitError struct {
+	Err   error
+	Limit int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v (limit %d)", e.Err, e.Limit)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+func (o ParseOptions) withDefaults() ParseOptions {
+	if o.MaxRequestLineBytes == 0 {
+		o.MaxRequestLineBytes = DefaultMaxRequestLineBytes
+	}
+	if o.MaxHeaderBytes == 0 {
+		o.MaxHeaderBytes = DefaultMaxHeaderBytes
+	}
+	if o.MaxHeaderCount == 0 {
+		o.MaxHeaderCount = DefaultMaxHeaderCount
+	}
+	if o.MaxBodyBytes == 0 {
+		o.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	return o
+}
+
+// grow doubles buf while keeping its first n bytes.
+func grow(buf []byte, n int) []byte {
+	bigger := make([]byte, 2*len(buf))
+	copy(bigger, buf[:n])
+	return bigger
+}
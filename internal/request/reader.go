@@ -0,0 +1,107 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Reader parses consecutive requests off a single connection. Bytes read past
+// the end of one request are kept for the next one, which is what makes
+// pipelining work.
+type Reader struct {
+	src    io.Reader
+	opts   ParseOptions
+	buf    []byte
+	bufLen int
+	last   *Request
+}
+
+func NewReader(src io.Reader, opts ParseOptions) *Reader {
+	return &Reader{
+		src:  src,
+		opts: opts,
+		buf:  make([]byte, initialBufferSize),
+	}
+}
+
+// ReadRequest parses the next request line and headers. Whatever was left
+// unread of the previous request body is discarded first. If the source ends
+// before any byte of a new request arrives, its error (usually io.EOF) is
+// returned as is.
+func (rd *Reader) ReadRequest() (*Request, error) {
+	if err := rd.finishLast(); err != nil {
+		return nil, err
+	}
+	request := newRequest(rd.opts)
+	request.body = &body{req: request, rd: rd}
+	request.BodyReader = request.body
+	rd.last = request
+	for {
+		if rd.bufLen > 0 {
+			readN, err := request.parse(rd.buf[:rd.bufLen])
+			if err != nil {
+				return nil, errors.Join(fmt.Errorf("error while parsing data"), err)
+			}
+			rd.consume(readN)
+			if request.headersDone() {
+				return request, nil
+			}
+		}
+		err := rd.fill()
+		if err != nil && request.state == StateInit && rd.bufLen == 0 {
+			return nil, err
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("error while reading buffer"), err)
+		}
+	}
+}
+
+// Peek blocks until at least one byte of the next request is available,
+// which lets callers tell an idle connection from a slow client. Like
+// ReadRequest, it first discards what is left of the previous body.
+func (rd *Reader) Peek() error {
+	if err := rd.finishLast(); err != nil {
+		return err
+	}
+	for rd.bufLen == 0 {
+		if err := rd.fill(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rd *Reader) finishLast() error {
+	if rd.last == nil {
+		return nil
+	}
+	if err := rd.last.discardBody(); err != nil {
+		return err
+	}
+	rd.last = nil
+	return nil
+}
+
+// fill reads once from the source into the free end of the buffer, growing it
+// when full. Parse limits keep the growth bounded.
+func (rd *Reader) fill() error {
+	if rd.bufLen == len(rd.buf) {
+		rd.buf = grow(rd.buf, rd.bufLen)
+	}
+	n, err := rd.src.Read(rd.buf[rd.bufLen:])
+	rd.bufLen += n
+	if n > 0 {
+		return nil
+	}
+	return err
+}
+
+func (rd *Reader) consume(n int) {
+	copy(rd.buf, rd.buf[n:rd.bufLen])
+	rd.bufLen -= n
+}
@@ -2,11 +2,16 @@ package request
 
 import (
 	"bytes"
-	"errors"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"httpfromtcp/internal/headers"
 	"io"
+	"math"
+	"mime/multipart"
 	"strconv"
+	"strings"
 )
 
 const (
@@ -15,10 +20,18 @@ const (
 	StateBody    string = "body"
 	StateDone    string = "done"
 	StateError   string = "error"
+
+	StateChunkSize    string = "chunk-size"
+	StateChunkData    string = "chunk-data"
+	StateChunkDataEnd string = "chunk-data-end"
+	StateTrailers     string = "trailers"
 )
 
 var ERROR_BAD_REQUEST_LINE = fmt.Errorf("bad request-line")
 var ERROR_INVALID_HTTP_VERSION = fmt.Errorf("invalid HTTP version")
+var ERROR_HTTP_VERSION_NOT_SUPPORTED = fmt.Errorf("HTTP version not supported")
+var ERROR_BAD_CHUNK_SIZE = fmt.Errorf("bad chunk-size line")
+var ERROR_BAD_CHUNK_DATA = fmt.Errorf("chunk-data not terminated by CRLF")
 var SEPARATOR = []byte("\r\n")
 
 type RequestLine struct {
@@ -29,28 +42,48 @@ type RequestLine struct {
 
 type Request struct {
 	RequestLine RequestLine
-	Headers     headers.Headers
+	// URL is RequestLine.RequestTarget parsed and normalised.
+	URL      URL
+	Headers  *headers.Headers
+	Trailers *headers.Headers
+	// BodyReader streams the request body straight from the connection,
+	// undoing any transfer coding. It is never nil.
+	BodyReader io.ReadCloser
+	// Body is only filled by ReadBody.
+	Body string
+	// Form, PostForm and MultipartForm are filled by ParseForm and
+	// ParseMultipartForm.
+	Form          Query
+	PostForm      Query
+	MultipartForm *multipart.Form
+	// TLS describes the connection for HTTPS requests and is nil otherwise.
+	TLS *tls.ConnectionState
+	// PathParams holds the values captured by the route pattern, if any.
+	PathParams  map[string]string
+	body        *body
+	ctx         context.Context
 	state       string
-	Body        string
-}
-
-func getInt(h headers.Headers, name string, defaultValue int) int {
-	valueStr, exists := h.Get(name)
-	if !exists {
-		return defaultValue
-	}
-	value, err := strconv.Atoi(valueStr)
-	if err != nil {
-		return defaultValue
-	}
-	return value
+	opts        ParseOptions
+	headerBytes int
+	headerCount int
+	bodyLeft    int
+	bodyRead    int
+	chunkLeft   int
+	pending     []byte
+	query       Query
+	// multipartParsed records that ParseMultipartForm ran, and multipartErr
+	// what it returned.
+	multipartParsed bool
+	multipartErr    error
 }
 
-func newRequest() *Request {
+func newRequest(opts ParseOptions) *Request {
 	return &Request{
-		state:   StateInit,
-		Headers: headers.NewHeaders(),
-		Body:    "",
+		opts:     opts.withDefaults(),
+		state:    StateInit,
+		Headers:  headers.NewHeaders(),
+		Trailers: headers.NewHeaders(),
+		Body:     "",
 	}
 }
 
@@ -61,28 +94,176 @@ func parseRequestLine(b []byte) (*RequestLine, int, error) {
 	}
 	startLn := b[:idx]
 	read := idx + len(SEPARATOR)
+	if bytes.ContainsAny(startLn, "\r\n") {
+		return nil, 0, headers.ERROR_BARE_LF
+	}
 	parts := bytes.Split(startLn, []byte(" "))
 
 	if len(parts) != 3 {
 		return nil, 0, ERROR_BAD_REQUEST_LINE
 	}
-	versionParts := bytes.Split(parts[2], []byte("/"))
-	if len(versionParts) != 2 || string(versionParts[0]) != "HTTP" || string(versionParts[1]) != "1.1" {
+	if !headers.IsToken(string(parts[0])) || len(parts[1]) == 0 {
+		return nil, 0, ERROR_BAD_REQUEST_LINE
+	}
+	major, minor, ok := parseHTTPVersion(parts[2])
+	if !ok {
 		return nil, 0, ERROR_INVALID_HTTP_VERSION
 	}
+	if major != 1 {
+		return nil, 0, ERROR_HTTP_VERSION_NOT_SUPPORTED
+	}
 
 	rl := &RequestLine{
 		Method:        string(parts[0]),
 		RequestTarget: string(parts[1]),
-		HttpVersion:   string(versionParts[1]),
+		HttpVersion:   fmt.Sprintf("%d.%d", major, minor),
 	}
 
 	return rl, read, nil
 }
 
-func (r *Request) hasBody() bool {
-	// chunked encoding pending
-	return getInt(r.Headers, "content-length", 0) > 0
+// parseHTTPVersion parses "HTTP/" DIGIT "." DIGIT (RFC 9112 section 2.3).
+func parseHTTPVersion(v []byte) (int, int, bool) {
+	if len(v) != len("HTTP/1.1") || !bytes.HasPrefix(v, []byte("HTTP/")) || v[6] != '.' {
+		return 0, 0, false
+	}
+	major, minor := v[5], v[7]
+	if major < '0' || major > '9' || minor < '0' || minor > '9' {
+		return 0, 0, false
+	}
+	return int(major - '0'), int(minor - '0'), true
+}
+
+// ProtoAtLeast reports whether the request uses HTTP major.minor or later.
+func (rl RequestLine) ProtoAtLeast(major, minor int) bool {
+	m, n, _ := parseHTTPVersion([]byte("HTTP/" + rl.HttpVersion))
+	return m > major || m == major && n >= minor
+}
+
+// parseChunkSize reads a chunk-size line, checking and then ignoring any
+// chunk extensions ("1a;name=value"). It returns 0 bytes read when the line
+// is incomplete.
+func parseChunkSize(b []byte) (int, int, error) {
+	idx := bytes.Index(b, SEPARATOR)
+	if idx == -1 {
+		return 0, 0, nil
+	}
+	line := b[:idx]
+	digits := 0
+	for digits < len(line) && isHexDigit(line[digits]) {
+		digits++
+	}
+	// 1*HEXDIG, so no sign, prefix or whitespace (RFC 9112 section 7.1)
+	if digits == 0 || !validChunkExt(line[digits:]) {
+		return 0, 0, ERROR_BAD_CHUNK_SIZE
+	}
+	size, err := strconv.ParseInt(string(line[:digits]), 16, 64)
+	if err != nil || size > math.MaxInt {
+		return 0, 0, ERROR_BAD_CHUNK_SIZE
+	}
+	return int(size), idx + len(SEPARATOR), nil
+}
+
+func isHexDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'f' || ch >= 'A' && ch <= 'F'
+}
+
+// validChunkExt matches ext against
+//
+//	chunk-ext = *( BWS ";" BWS chunk-ext-name [ BWS "=" BWS chunk-ext-val ] )
+//
+// where names are tokens and values tokens or quoted strings (RFC 9112
+// section 7.1.1). Anything else, bare CR and LF included, is refused.
+func validChunkExt(ext []byte) bool {
+	skipBWS := func() {
+		ext = bytes.TrimLeft(ext, " \t")
+	}
+	token := func() bool {
+		n := 0
+		for n < len(ext) && headers.IsToken(string(ext[n:n+1])) {
+			n++
+		}
+		ext = ext[n:]
+		return n > 0
+	}
+	for {
+		skipBWS()
+		if len(ext) == 0 {
+			return true
+		}
+		if ext[0] != ';' {
+			return false
+		}
+		ext = ext[1:]
+		skipBWS()
+		if !token() {
+			return false
+		}
+		skipBWS()
+		if len(ext) == 0 || ext[0] != '=' {
+			continue
+		}
+		ext = ext[1:]
+		skipBWS()
+		if len(ext) > 0 && ext[0] == '"' {
+			n, ok := quotedStringLen(ext)
+			if !ok {
+				return false
+			}
+			ext = ext[n:]
+		} else if !token() {
+			return false
+		}
+	}
+}
+
+// quotedStringLen returns the length of the quoted-string at the start of b.
+func quotedStringLen(b []byte) (int, bool) {
+	for i := 1; i < len(b); i++ {
+		ch := b[i]
+		switch {
+		case ch == '"':
+			return i + 1, true
+		case ch == '\\':
+			i++
+			if i == len(b) || b[i] < ' ' && b[i] != '\t' || b[i] == 0x7f {
+				return 0, false
+			}
+		case ch < ' ' && ch != '\t' || ch == 0x7f:
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// parseFields runs h.Parse on data and accounts the consumed bytes and field
+// lines against the header limits, which trailers share with headers.
+func (r *Request) parseFields(h *headers.Headers, data []byte) (int, bool, error) {
+	n, done, err := h.ParseWithOptions(data, headers.ParseOptions{UnfoldObsFold: r.opts.UnfoldObsFold})
+	if err != nil {
+		return 0, false, err
+	}
+	r.headerBytes += n
+	r.headerCount += bytes.Count(data[:n], SEPARATOR)
+	if done {
+		r.headerCount--
+	}
+	if r.headerBytes > r.opts.MaxHeaderBytes || (!done && r.headerBytes+len(data)-n > r.opts.MaxHeaderBytes) {
+		return 0, false, &LimitError{Err: ERROR_HEADERS_TOO_LARGE, Limit: r.opts.MaxHeaderBytes}
+	}
+	if r.headerCount > r.opts.MaxHeaderCount {
+		return 0, false, &LimitError{Err: ERROR_TOO_MANY_HEADERS, Limit: r.opts.MaxHeaderCount}
+	}
+	return n, done, nil
+}
+
+func (r *Request) checkBodySize(n int) error {
+	r.bodyRead += n
+	if r.opts.MaxBodyBytes > 0 && r.bodyRead > r.opts.MaxBodyBytes {
+		r.state = StateError
+		return &LimitError{Err: ERROR_BODY_TOO_LARGE, Limit: r.opts.MaxBodyBytes}
+	}
+	return nil
 }
 
 func (r *Request) parse(data []byte) (int, error) {
@@ -95,18 +276,33 @@ outer:
 		}
 		switch r.state {
 		case StateInit:
+			// RFC 9112 section 2.2: ignore empty lines preceding the request-line
+			if bytes.HasPrefix(currentData, SEPARATOR) {
+				read += len(SEPARATOR)
+				continue
+			}
 			rl, n, err := parseRequestLine(currentData)
 			if err != nil {
 				return 0, err
 			}
+			if n-len(SEPARATOR) > r.opts.MaxRequestLineBytes || (n == 0 && len(currentData) > r.opts.MaxRequestLineBytes) {
+				r.state = StateError
+				return 0, &LimitError{Err: ERROR_REQUEST_LINE_TOO_LONG, Limit: r.opts.MaxRequestLineBytes}
+			}
 			if n == 0 {
 				break outer
 			}
+			u, err := parseTarget(rl.Method, rl.RequestTarget)
+			if err != nil {
+				r.state = StateError
+				return 0, err
+			}
 			r.RequestLine = *rl
+			r.URL = u
 			read += n
 			r.state = StateHeaders
 		case StateHeaders:
-			n, done, err := r.Headers.Parse(currentData)
+			n, done, err := r.parseFields(r.Headers, currentData)
 			if err != nil {
 				r.state = StateError
 				return 0, err
@@ -116,18 +312,78 @@ outer:
 			}
 			read += n
 			if done {
-				if r.hasBody() {
-					r.state = StateBody
-				} else {
-					r.state = StateDone
+				if err := r.setFraming(); err != nil {
+					r.state = StateError
+					return 0, err
 				}
+				// the body is consumed lazily through BodyReader
+				break outer
 			}
 		case StateBody:
-			length := getInt(r.Headers, "content-length", 0)
-			remaining := min(length-len(r.Body), len(currentData))
-			r.Body += string(currentData[:remaining])
+			remaining := min(r.bodyLeft, len(currentData))
+			r.pending = append(r.pending, currentData[:remaining]...)
 			read += remaining
-			if len(r.Body) == length {
+			r.bodyLeft -= remaining
+			if r.bodyLeft == 0 {
+				r.state = StateDone
+			}
+		case StateChunkSize:
+			size, n, err := parseChunkSize(currentData)
+			if err != nil {
+				r.state = StateError
+				return 0, err
+			}
+			if n == 0 {
+				if len(currentData) > maxChunkSizeLine {
+					r.state = StateError
+					return 0, ERROR_BAD_CHUNK_SIZE
+				}
+				break outer
+			}
+			// refuse a chunk that cannot fit before reading any of it
+			if r.opts.MaxBodyBytes > 0 && size > r.opts.MaxBodyBytes-r.bodyRead {
+				r.state = StateError
+				return 0, &LimitError{Err: ERROR_BODY_TOO_LARGE, Limit: r.opts.MaxBodyBytes}
+			}
+			read += n
+			r.chunkLeft = size
+			if size == 0 {
+				r.state = StateTrailers
+			} else {
+				r.state = StateChunkData
+			}
+		case StateChunkData:
+			remaining := min(r.chunkLeft, len(currentData))
+			if err := r.checkBodySize(remaining); err != nil {
+				return 0, err
+			}
+			r.pending = append(r.pending, currentData[:remaining]...)
+			read += remaining
+			r.chunkLeft -= remaining
+			if r.chunkLeft == 0 {
+				r.state = StateChunkDataEnd
+			}
+		case StateChunkDataEnd:
+			if len(currentData) < len(SEPARATOR) {
+				break outer
+			}
+			if !bytes.HasPrefix(currentData, SEPARATOR) {
+				r.state = StateError
+				return 0, ERROR_BAD_CHUNK_DATA
+			}
+			read += len(SEPARATOR)
+			r.state = StateChunkSize
+		case StateTrailers:
+			n, done, err := r.parseFields(r.Trailers, currentData)
+			if err != nil {
+				r.state = StateError
+				return 0, err
+			}
+			if n == 0 {
+				break outer
+			}
+			read += n
+			if done {
 				r.state = StateDone
 			}
 		case StateDone:
@@ -143,22 +399,79 @@ func (r *Request) done() bool {
 	return r.state == StateDone
 }
 
-func RequestFromReader(reader io.Reader) (*Request, error) {
-	request := newRequest()
-	buf := make([]byte, 1024)
-	bufLen := 0
-	for !request.done() {
-		n, err := reader.Read(buf[bufLen:])
-		if err != nil {
-			return nil, errors.Join(fmt.Errorf("error while reading buffer"), err)
-		}
-		bufLen += n
-		readN, err := request.parse(buf[:bufLen])
-		if err != nil {
-			return nil, errors.Join(fmt.Errorf("error while parsing data"), err)
-		}
-		copy(buf, buf[readN:bufLen])
-		bufLen -= readN
+func (r *Request) headersDone() bool {
+	return r.state != StateInit && r.state != StateHeaders
+}
+
+// Context returns the request's context. It is never nil.
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
 	}
-	return request, nil
+	return r.ctx
+}
+
+// WithContext returns a shallow copy of r carrying ctx. Both share the same
+// body.
+func (r *Request) WithContext(ctx context.Context) *Request {
+	r2 := *r
+	r2.ctx = ctx
+	return &r2
+}
+
+// ClientCertificate returns the certificate the client authenticated with
+// over mutual TLS, or nil.
+func (r *Request) ClientCertificate() *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return r.TLS.PeerCertificates[0]
+}
+
+// PathParam returns the value the route pattern captured for name.
+func (r *Request) PathParam(name string) string {
+	return r.PathParams[name]
+}
+
+// KeepAlive reports whether the client is willing to send another request on
+// the same connection. HTTP/1.1 connections persist unless closed, HTTP/1.0
+// ones only when the client asks for keep-alive.
+func (r *Request) KeepAlive() bool {
+	if r.Headers.HasToken("connection", "close") {
+		return false
+	}
+	return r.RequestLine.ProtoAtLeast(1, 1) || r.Headers.HasToken("connection", "keep-alive")
+}
+
+// ExpectsContinue reports whether the client waits for a 100 Continue
+// interim response before sending the body (RFC 9110 section 10.1.1).
+func (r *Request) ExpectsContinue() bool {
+	expect, _ := r.Headers.Get("expect")
+	return strings.EqualFold(expect, "100-continue") && r.RequestLine.ProtoAtLeast(1, 1) && r.headersDone() && !r.done()
+}
+
+// OnBodyRead registers fn to run right before the body is first read. An
+// error from fn fails that read. The server uses it to send 100 Continue.
+func (r *Request) OnBodyRead(fn func() error) {
+	r.body.onFirstRead = fn
+}
+
+// ReadBody drains BodyReader into Body and returns it. It is meant for small
+// payloads; handlers accepting large uploads should stream BodyReader instead.
+func (r *Request) ReadBody() (string, error) {
+	b, err := io.ReadAll(r.BodyReader)
+	r.Body += string(b)
+	return r.Body, err
+}
+
+// RequestFromReader parses the request line and headers using the default
+// ParseOptions. The body is left on the reader and exposed through BodyReader.
+func RequestFromReader(reader io.Reader) (*Request, error) {
+	return RequestFromReaderWithOptions(reader, ParseOptions{})
+}
+
+// RequestFromReaderWithOptions is RequestFromReader with explicit limits.
+// Exceeding one of them returns a *LimitError.
+func RequestFromReaderWithOptions(reader io.Reader, opts ParseOptions) (*Request, error) {
+	return NewReader(reader, opts).ReadRequest()
 }
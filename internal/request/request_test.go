@@ -1,7 +1,13 @@
 package request
 
 import (
+	"bytes"
+	"httpfromtcp/internal/headers"
 	"io"
+	"mime/multipart"
+	"os"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -29,7 +35,7 @@ func (cr *chunkReader) Read(p []byte) (n int, err error) {
 
 	return n, nil
 }
-func RequestLineParse(t *testing.T) {
+func TestRequestLineParse(t *testing.T) {
 	// Test: Good GET Request line
 	reader := &chunkReader{
 		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
@@ -55,7 +61,7 @@ func RequestLineParse(t *testing.T) {
 	assert.Equal(t, "1.1", r.RequestLine.HttpVersion)
 }
 
-func RequestHeaders(t *testing.T) {
+func TestRequestHeaders(t *testing.T) {
 	// Test: Standard Headers
 	reader := &chunkReader{
 		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
@@ -96,7 +102,10 @@ func TestParceBody(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "hello world!\n", string(r.Body))
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", body)
+	assert.Equal(t, "hello world!\n", r.Body)
 
 	// Test: Body shorter than reported content length
 	reader = &chunkReader{
@@ -108,5 +117,526 @@ func TestParceBody(t *testing.T) {
 		numBytesPerRead: 3,
 	}
 	r, err = RequestFromReader(reader)
-	require.Error(t, err)
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Test: Body is streamed in caller-sized pieces
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Content-Length: 26\r\n" +
+			"\r\n" +
+			"abcdefghijklmnopqrstuvwxyz",
+		numBytesPerRead: 7,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "", r.Body)
+	p := make([]byte, 4)
+	n, err := r.BodyReader.Read(p)
+	require.NoError(t, err)
+	assert.Equal(t, "abcd", string(p[:n]))
+	rest, err := io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, "efghijklmnopqrstuvwxyz", string(rest))
+
+	// Test: No body
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "", body)
+}
+
+func TestParseChunkedBody(t *testing.T) {
+	// Test: Standard chunked body
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n" +
+			"7\r\n world!\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!", body)
+
+	// Test: Chunk extensions and trailers
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: X-Checksum\r\n" +
+			"\r\n" +
+			"A;name=value\r\n0123456789\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc123\r\n" +
+			"\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", body)
+	checksum, ok := r.Trailers.Get("x-checksum")
+	assert.True(t, ok)
+	assert.Equal(t, "abc123", checksum)
+
+	// Test: Invalid chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"zz\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, ERROR_BAD_CHUNK_SIZE)
+
+	// Test: Chunk data longer than chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, ERROR_BAD_CHUNK_DATA)
+}
+
+func TestParseLimits(t *testing.T) {
+	// Test: Headers bigger than the initial buffer
+	reader := &chunkReader{
+		data: "GET / HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Cookie: " + strings.Repeat("a", 3000) + "\r\n" +
+			"\r\n",
+		numBytesPerRead: 512,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	cookie, ok := r.Headers.Get("cookie")
+	assert.True(t, ok)
+	assert.Len(t, cookie, 3000)
+
+	// Test: Request line too long
+	reader = &chunkReader{
+		data:            "GET /" + strings.Repeat("a", 100) + " HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 8,
+	}
+	_, err = RequestFromReaderWithOptions(reader, ParseOptions{MaxRequestLineBytes: 64})
+	require.ErrorIs(t, err, ERROR_REQUEST_LINE_TOO_LONG)
+	var limitErr *LimitError
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, 64, limitErr.Limit)
+
+	// Test: Header section too large
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nX-Big: " + strings.Repeat("a", 200) + "\r\n\r\n",
+		numBytesPerRead: 8,
+	}
+	_, err = RequestFromReaderWithOptions(reader, ParseOptions{MaxHeaderBytes: 128})
+	require.ErrorIs(t, err, ERROR_HEADERS_TOO_LARGE)
+
+	// Test: Too many header fields
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReaderWithOptions(reader, ParseOptions{MaxHeaderCount: 2})
+	require.ErrorIs(t, err, ERROR_TOO_MANY_HEADERS)
+
+	// Test: Content-Length over the body limit
+	reader = &chunkReader{
+		data:            "POST / HTTP/1.1\r\nContent-Length: 100\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReaderWithOptions(reader, ParseOptions{MaxBodyBytes: 10})
+	require.ErrorIs(t, err, ERROR_BODY_TOO_LARGE)
+
+	// Test: Chunked body over the body limit
+	reader = &chunkReader{
+		data:            "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n8\r\n12345678\r\n8\r\n12345678\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReaderWithOptions(reader, ParseOptions{MaxBodyBytes: 10})
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, ERROR_BODY_TOO_LARGE)
+
+	// Test: A chunk of 2 GiB or more is refused by the limit, not as bad syntax
+	reader = &chunkReader{
+		data:            "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n80000000\r\nabc",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReaderWithOptions(reader, ParseOptions{MaxBodyBytes: 10})
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, ERROR_BODY_TOO_LARGE, limitErr.Err)
+}
+
+func TestReaderPipelining(t *testing.T) {
+	// Test: Pipelined requests with an unread body in between
+	reader := &chunkReader{
+		data: "POST /first HTTP/1.1\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello" +
+			"\r\n" +
+			"GET /second HTTP/1.1\r\n" +
+			"Connection: close\r\n" +
+			"\r\n",
+		numBytesPerRead: 1024,
+	}
+	rd := NewReader(reader, ParseOptions{})
+	r, err := rd.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/first", r.RequestLine.RequestTarget)
+	assert.True(t, r.KeepAlive())
+	r, err = rd.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/second", r.RequestLine.RequestTarget)
+	assert.False(t, r.KeepAlive())
+	_, err = rd.ReadRequest()
+	assert.Equal(t, io.EOF, err)
+
+	// Test: Pipelined chunked request followed by another request
+	reader = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nabc\r\n0\r\n\r\n" +
+			"GET /next HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 5,
+	}
+	rd = NewReader(reader, ParseOptions{})
+	r, err = rd.ReadRequest()
+	require.NoError(t, err)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "abc", body)
+	r, err = rd.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/next", r.RequestLine.RequestTarget)
+
+	// Test: Truncated request after a complete one
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\n\r\nGET /partial HT",
+		numBytesPerRead: 4,
+	}
+	rd = NewReader(reader, ParseOptions{})
+	_, err = rd.ReadRequest()
+	require.NoError(t, err)
+	_, err = rd.ReadRequest()
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestHTTPVersion(t *testing.T) {
+	// Test: HTTP/1.0 is accepted and closes by default
+	r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.0\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", r.RequestLine.HttpVersion)
+	assert.False(t, r.RequestLine.ProtoAtLeast(1, 1))
+	assert.False(t, r.KeepAlive())
+
+	// Test: HTTP/1.0 keep-alive is opt-in
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.0\r\nConnection: Keep-Alive\r\n\r\n"))
+	require.NoError(t, err)
+	assert.True(t, r.KeepAlive())
+
+	// Test: Later HTTP/1.x minor versions are served as HTTP/1.1
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.2\r\n\r\n"))
+	require.NoError(t, err)
+	assert.True(t, r.RequestLine.ProtoAtLeast(1, 1))
+	assert.True(t, r.KeepAlive())
+
+	// Test: HTTP/2 and later are not supported
+	_, err = RequestFromReader(strings.NewReader("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"))
+	require.ErrorIs(t, err, ERROR_HTTP_VERSION_NOT_SUPPORTED)
+
+	// Test: Malformed versions
+	for _, version := range []string{"HTTP/1", "HTTP/1.10", "http/1.1", "HTTP/x.1"} {
+		_, err = RequestFromReader(strings.NewReader("GET / " + version + "\r\n\r\n"))
+		require.ErrorIs(t, err, ERROR_INVALID_HTTP_VERSION, version)
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	// Test: Each request-target form
+	tests := []struct {
+		line string
+		want URL
+	}{
+		{"GET /a/b?x=1 HTTP/1.1", URL{Form: TargetOrigin, Path: "/a/b", Segments: []string{"a", "b"}, RawPath: "/a/b", RawQuery: "x=1"}},
+		{"GET http://Example.com:8080/p?q HTTP/1.1", URL{Form: TargetAbsolute, Scheme: "http", Host: "Example.com:8080", Path: "/p", Segments: []string{"p"}, RawPath: "/p", RawQuery: "q"}},
+		{"GET HTTPS://example.com HTTP/1.1", URL{Form: TargetAbsolute, Scheme: "https", Host: "example.com", Path: "/", Segments: []string{""}, RawPath: "/"}},
+		{"CONNECT example.com:443 HTTP/1.1", URL{Form: TargetAuthority, Host: "example.com:443"}},
+		{"CONNECT [::1]:443 HTTP/1.1", URL{Form: TargetAuthority, Host: "[::1]:443"}},
+		{"OPTIONS * HTTP/1.1", URL{Form: TargetAsterisk, Path: "*", RawPath: "*"}},
+	}
+	for _, tt := range tests {
+		r, err := RequestFromReader(strings.NewReader(tt.line + "\r\n\r\n"))
+		require.NoError(t, err, tt.line)
+		assert.Equal(t, tt.want, r.URL, tt.line)
+	}
+
+	// Test: Paths are decoded and normalised
+	paths := map[string]string{
+		"/":                "/",
+		"/a//b/":           "/a/b/",
+		"/a/./b/../c":      "/a/c",
+		"/a/b/..":          "/a/",
+		"/caf%C3%A9/x%20y": "/café/x y",
+		"/a/%2e%2e/b":      "/b",
+		"/a%2Fb":           "/a/b",
+	}
+	for target, want := range paths {
+		r, err := RequestFromReader(strings.NewReader("GET " + target + " HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err, target)
+		assert.Equal(t, want, r.URL.Path, target)
+		assert.Equal(t, target, r.URL.RawPath, target)
+	}
+
+	// Test: An encoded slash stays inside its segment
+	r, err := RequestFromReader(strings.NewReader("GET /users/a%2Fb/ HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"users", "a/b", ""}, r.URL.Segments)
+
+	// Test: Traversal and malformed targets are rejected
+	_, err = RequestFromReader(strings.NewReader("GET /a/../../etc/passwd HTTP/1.1\r\n\r\n"))
+	require.ErrorIs(t, err, ERROR_PATH_TRAVERSAL)
+	for _, target := range []string{"/%2e%2e/etc", "/a%2F..%2F..%2Fetc/passwd", "/..%2Fetc", "/a/.%2Fb"} {
+		_, err = RequestFromReader(strings.NewReader("GET " + target + " HTTP/1.1\r\n\r\n"))
+		require.ErrorIs(t, err, ERROR_PATH_TRAVERSAL, target)
+	}
+	for _, line := range []string{
+		"GET * HTTP/1.1",
+		"GET a/b HTTP/1.1",
+		"GET /a%zz HTTP/1.1",
+		"GET /a%00 HTTP/1.1",
+		"GET /a#frag HTTP/1.1",
+		"GET /\x1b HTTP/1.1",
+		"GET /caf\xc3\xa9 HTTP/1.1",
+		"GET ftp://example.com/ HTTP/1.1",
+		"GET http://user@example.com/ HTTP/1.1",
+		"GET http://# HTTP/1.1",
+		"GET http://[::1/ HTTP/1.1",
+		"CONNECT example.com HTTP/1.1",
+		"CONNECT /path HTTP/1.1",
+		"CONNECT 0:A HTTP/1.1",
+		"CONNECT %:0 HTTP/1.1",
+	} {
+		_, err = RequestFromReader(strings.NewReader(line + "\r\n\r\n"))
+		require.ErrorIs(t, err, ERROR_BAD_REQUEST_TARGET, line)
+	}
+
+	// Test: Query parameters keep every value in order
+	r, err = RequestFromReader(strings.NewReader("GET /search?tag=a&q=hello+world&tag=b&empty=&bad=%zz HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	q := r.Query()
+	assert.Equal(t, []string{"a", "b"}, q.Values("tag"))
+	assert.Equal(t, "a", q.Get("tag"))
+	assert.Equal(t, "hello world", q.Get("q"))
+	assert.True(t, q.Has("empty"))
+	assert.False(t, q.Has("bad"))
+	assert.Equal(t, "", q.Get("missing"))
+}
+
+func TestParseForm(t *testing.T) {
+	// Test: urlencoded body values come before query ones
+	body := "name=Ada+Lovelace&tag=a&tag=b"
+	r, err := RequestFromReader(strings.NewReader("POST /form?tag=q&page=2 HTTP/1.1\r\n" +
+		"Content-Type: application/x-www-form-urlencoded; charset=utf-8\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body))
+	require.NoError(t, err)
+	require.NoError(t, r.ParseForm())
+	assert.Equal(t, "Ada Lovelace", r.PostForm.Get("name"))
+	assert.Equal(t, []string{"a", "b"}, r.PostForm.Values("tag"))
+	assert.False(t, r.PostForm.Has("page"))
+	assert.Equal(t, []string{"a", "b", "q"}, r.Form.Values("tag"))
+	assert.Equal(t, "2", r.FormValue("page"))
+
+	// Test: GET only uses the query
+	r, err = RequestFromReader(strings.NewReader("GET /?a=1 HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	require.NoError(t, r.ParseForm())
+	assert.Equal(t, "1", r.Form.Get("a"))
+	assert.Empty(t, r.PostForm)
+	require.ErrorIs(t, r.ParseMultipartForm(DefaultMaxMemory), ERROR_NOT_MULTIPART)
+
+	// Test: FormValue reads the query of a plain GET
+	r, err = RequestFromReader(strings.NewReader("GET /?x=1 HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "1", r.FormValue("x"))
+
+	// Test: FormValue reads an urlencoded body
+	r, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\n" +
+		"Content-Type: application/x-www-form-urlencoded\r\nContent-Length: 3\r\n\r\ny=2"))
+	require.NoError(t, err)
+	assert.Equal(t, "2", r.FormValue("y"))
+	assert.Equal(t, "2", r.PostForm.Get("y"))
+
+	// Test: Later calls reuse the first result instead of parsing again
+	r.Headers.Set("Content-Type", "multipart/form-data; boundary=x")
+	assert.Equal(t, "2", r.FormValue("y"))
+	require.ErrorIs(t, r.ParseMultipartForm(DefaultMaxMemory), ERROR_NOT_MULTIPART)
+}
+
+func TestParseMultipartForm(t *testing.T) {
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	require.NoError(t, mw.WriteField("title", "holiday"))
+	fw, err := mw.CreateFormFile("photo", "beach.jpg")
+	require.NoError(t, err)
+	content := strings.Repeat("x", 4096)
+	fw.Write([]byte(content))
+	fw, err = mw.CreateFormFile("notes", "notes.txt")
+	require.NoError(t, err)
+	fw.Write([]byte("short"))
+	require.NoError(t, mw.Close())
+	raw := "POST /upload?album=1 HTTP/1.1\r\n" +
+		"Content-Type: " + mw.FormDataContentType() + "\r\n" +
+		"Content-Length: " + strconv.Itoa(buf.Len()) + "\r\n\r\n" + buf.String()
+
+	// Test: Fields and files are exposed, large files spill to disk
+	r, err := RequestFromReader(&chunkReader{data: raw, numBytesPerRead: 100})
+	require.NoError(t, err)
+	require.NoError(t, r.ParseMultipartForm(1024))
+	assert.Equal(t, "holiday", r.FormValue("title"))
+	assert.Equal(t, "holiday", r.PostForm.Get("title"))
+	assert.Equal(t, "1", r.FormValue("album"))
+
+	f, fh, err := r.FormFile("photo")
+	require.NoError(t, err)
+	assert.Equal(t, "beach.jpg", fh.Filename)
+	assert.Equal(t, int64(len(content)), fh.Size)
+	spilled, ok := f.(*os.File)
+	require.True(t, ok, "file part should be on disk")
+	b, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(b))
+	f.Close()
+
+	f, _, err = r.FormFile("notes")
+	require.NoError(t, err)
+	b, _ = io.ReadAll(f)
+	assert.Equal(t, "short", string(b))
+
+	_, _, err = r.FormFile("missing")
+	require.ErrorIs(t, err, ERROR_MISSING_FILE)
+
+	// Test: RemoveForm deletes the temporary files
+	require.NoError(t, r.RemoveForm())
+	_, err = os.Stat(spilled.Name())
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRequestFraming(t *testing.T) {
+	// Test: Ambiguous framing is refused
+	tests := map[string]error{
+		"Content-Length: 5, 10\r\n":                              ERROR_BAD_CONTENT_LENGTH,
+		"Content-Length: 5\r\nContent-Length: 5\r\n":             ERROR_BAD_CONTENT_LENGTH,
+		"Content-Length: +5\r\n":                                 ERROR_BAD_CONTENT_LENGTH,
+		"Content-Length: -1\r\n":                                 ERROR_BAD_CONTENT_LENGTH,
+		"Content-Length: 0x10\r\n":                               ERROR_BAD_CONTENT_LENGTH,
+		"Content-Length: 99999999999999999999\r\n":               ERROR_BAD_CONTENT_LENGTH,
+		"Content-Length:\r\n":                                    ERROR_BAD_CONTENT_LENGTH,
+		"Content-Length: 5\r\nTransfer-Encoding: chunked\r\n":    ERROR_CONFLICTING_FRAMING,
+		"Transfer-Encoding: gzip, chunked\r\n":                   ERROR_UNSUPPORTED_TRANSFER_CODING,
+		"Transfer-Encoding: chunked\r\nTransfer-Encoding: x\r\n": ERROR_UNSUPPORTED_TRANSFER_CODING,
+		"Transfer-Encoding: chunked, chunked\r\n":                ERROR_UNSUPPORTED_TRANSFER_CODING,
+		"Transfer-Encoding: identity\r\n":                        ERROR_UNSUPPORTED_TRANSFER_CODING,
+		"Host: x\nTransfer-Encoding: chunked\r\n":                headers.ERROR_BARE_LF,
+		"Transfer-Encoding : chunked\r\n":                        headers.ERROR_WHITESPACE_BEFORE_COLON,
+		"Transfer-Encoding: chunked\r\nContent-Length : 10\r\n":  headers.ERROR_WHITESPACE_BEFORE_COLON,
+		"Content-Length: 3\r\nTransfer-Encoding: \tchunked \r\n": ERROR_CONFLICTING_FRAMING,
+	}
+	for fields, want := range tests {
+		_, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\n" + fields + "\r\nabc"))
+		require.ErrorIs(t, err, want, fields)
+	}
+	_, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nContent-Length: 1,2\r\n\r\n"))
+	var framingErr *FramingError
+	require.ErrorAs(t, err, &framingErr)
+	assert.Equal(t, "1,2", framingErr.Value)
+
+	// Test: Transfer-Encoding is not allowed in HTTP/1.0
+	_, err = RequestFromReader(strings.NewReader("POST / HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n"))
+	require.ErrorIs(t, err, ERROR_UNSUPPORTED_TRANSFER_CODING)
+
+	// Test: Bare LF in the request line
+	_, err = RequestFromReader(strings.NewReader("GET /\n HTTP/1.1\r\n\r\n"))
+	require.ErrorIs(t, err, headers.ERROR_BARE_LF)
+
+	// Test: Transfer codings are case-insensitive and trimmed
+	r, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nTransfer-Encoding: Chunked \r\n\r\n3\r\nabc\r\n0\r\n\r\n"))
+	require.NoError(t, err)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "abc", body)
+
+	// Test: Chunk sizes are bare hex and extensions follow the grammar
+	for _, chunk := range []string{"+3\r\nabc", " 3\r\nabc", "0x3\r\nabc", "-0\r\n", "5;a\nb\r\nhello", "5;=x\r\nhello", "5;a=\"x\r\nhello"} {
+		r, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n" + chunk + "\r\n0\r\n\r\n"))
+		require.NoError(t, err)
+		_, err = r.ReadBody()
+		require.ErrorIs(t, err, ERROR_BAD_CHUNK_SIZE, chunk)
+	}
+	r, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3 ; a = \"x\\\";y\" ;b\r\nabc\r\n0\r\n\r\n"))
+	require.NoError(t, err)
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "abc", body)
+}
+
+func TestObsFoldPolicy(t *testing.T) {
+	raw := "GET / HTTP/1.1\r\nX-Legacy: a\r\n b\r\n\r\n"
+
+	// Test: Folded fields are rejected by default
+	_, err := RequestFromReader(strings.NewReader(raw))
+	require.ErrorIs(t, err, headers.ERROR_OBS_FOLD)
+
+	// Test: UnfoldObsFold joins them with a space
+	r, err := RequestFromReaderWithOptions(strings.NewReader(raw), ParseOptions{UnfoldObsFold: true})
+	require.NoError(t, err)
+	v, _ := r.Headers.Get("x-legacy")
+	assert.Equal(t, "a b", v)
+}
+
+func TestRequestCookies(t *testing.T) {
+	r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost\r\nCookie: session=abc; theme=\"dark\"\r\nCookie: bad cookie; lang=es\r\n\r\n"))
+	require.NoError(t, err)
+
+	// Test: Every Cookie field is read, in order
+	names := []string{}
+	for _, c := range r.Cookies() {
+		names = append(names, c.Name+"="+c.Value)
+	}
+	assert.Equal(t, []string{"session=abc", "theme=dark", "lang=es"}, names)
+
+	// Test: Lookup by name
+	c, err := r.Cookie("lang")
+	require.NoError(t, err)
+	assert.Equal(t, "es", c.Value)
+	_, err = r.Cookie("Session")
+	assert.ErrorIs(t, err, ERROR_NO_COOKIE)
 }
@@ -0,0 +1,220 @@
+package request
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const (
+	TargetOrigin    string = "origin"
+	TargetAbsolute  string = "absolute"
+	TargetAuthority string = "authority"
+	TargetAsterisk  string = "asterisk"
+)
+
+var ERROR_BAD_REQUEST_TARGET = fmt.Errorf("bad request-target")
+var ERROR_PATH_TRAVERSAL = fmt.Errorf("request path escapes the root")
+
+// URL is the parsed request-target (RFC 9112 section 3.2).
+type URL struct {
+	// Form is one of the Target* constants.
+	Form string
+	// Scheme and Host are only set by the absolute and authority forms.
+	Scheme string
+	Host   string
+	// Path is percent-decoded with dot-segments and duplicate slashes
+	// removed. It is "*" for the asterisk form and empty for the authority
+	// form.
+	Path string
+	// Segments are the segments of Path, split before decoding so that an
+	// encoded slash stays inside its segment. Routers match against these.
+	Segments []string
+	// RawPath is the path as sent.
+	RawPath  string
+	RawQuery string
+}
+
+// Query holds the query parameters, each name mapping to all its values in
+// order.
+type Query map[string][]string
+
+// Get returns the first value for name, or "".
+func (q Query) Get(name string) string {
+	if v := q[name]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// Values returns every value given for name.
+func (q Query) Values(name string) []string {
+	return q[name]
+}
+
+func (q Query) Has(name string) bool {
+	_, ok := q[name]
+	return ok
+}
+
+func parseTarget(method, target string) (URL, error) {
+	// a URI is printable US-ASCII; anything else must be percent-encoded
+	for i := 0; i < len(target); i++ {
+		if target[i] <= ' ' || target[i] >= 0x7f {
+			return URL{}, ERROR_BAD_REQUEST_TARGET
+		}
+	}
+	switch {
+	case target == "*":
+		if method != "OPTIONS" {
+			return URL{}, ERROR_BAD_REQUEST_TARGET
+		}
+		return URL{Form: TargetAsterisk, Path: "*", RawPath: "*"}, nil
+	case method == "CONNECT":
+		// authority-form: host ":" port, nothing else
+		if port, ok := validAuthority(target); !ok || port == "" {
+			return URL{}, ERROR_BAD_REQUEST_TARGET
+		}
+		return URL{Form: TargetAuthority, Host: target}, nil
+	case strings.HasPrefix(target, "/"):
+		u := URL{Form: TargetOrigin}
+		return u, u.setPath(target)
+	}
+	scheme, rest, ok := strings.Cut(target, "://")
+	if !ok || !(strings.EqualFold(scheme, "http") || strings.EqualFold(scheme, "https")) {
+		return URL{}, ERROR_BAD_REQUEST_TARGET
+	}
+	u := URL{Form: TargetAbsolute, Scheme: strings.ToLower(scheme)}
+	end := strings.IndexAny(rest, "/?")
+	if end == -1 {
+		end = len(rest)
+	}
+	u.Host = rest[:end]
+	if _, ok := validAuthority(u.Host); !ok {
+		return URL{}, ERROR_BAD_REQUEST_TARGET
+	}
+	rest = rest[end:]
+	if !strings.HasPrefix(rest, "/") {
+		rest = "/" + rest
+	}
+	return u, u.setPath(rest)
+}
+
+// validAuthority checks a host [":" port] authority, without userinfo,
+// against RFC 3986 section 3.2: the host is an IP-literal in brackets or a
+// non-empty reg-name, which covers IPv4 addresses, and the port is all
+// digits. It returns the port.
+func validAuthority(authority string) (string, bool) {
+	var port string
+	if strings.HasPrefix(authority, "[") {
+		end := strings.IndexByte(authority, ']')
+		if end == -1 {
+			return "", false
+		}
+		addr, err := netip.ParseAddr(authority[1:end])
+		if err != nil || !addr.Is6() || addr.Zone() != "" {
+			return "", false
+		}
+		port = authority[end+1:]
+		if port != "" && port[0] != ':' {
+			return "", false
+		}
+		port = strings.TrimPrefix(port, ":")
+	} else {
+		var host string
+		host, port, _ = strings.Cut(authority, ":")
+		if !validRegName(host) {
+			return "", false
+		}
+	}
+	for i := 0; i < len(port); i++ {
+		if port[i] < '0' || port[i] > '9' {
+			return "", false
+		}
+	}
+	return port, true
+}
+
+// validRegName accepts unreserved and sub-delims characters and, as net/url
+// does, percent-encoding of non-ASCII bytes only.
+func validRegName(host string) bool {
+	if host == "" {
+		return false
+	}
+	for i := 0; i < len(host); i++ {
+		ch := host[i]
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9':
+		case strings.IndexByte("-._~!$&'()*+,;=", ch) != -1:
+		case ch == '%':
+			if i+2 >= len(host) || !isHexDigit(host[i+1]) || !isHexDigit(host[i+2]) || host[i+1] < '8' {
+				return false
+			}
+			i += 2
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// setPath splits off the query and normalises the path of an origin-form
+// target, rejecting dot-segments that would climb above the root. A segment
+// holding an encoded slash may not hide a dot-segment either, since Path
+// shows it decoded.
+func (u *URL) setPath(target string) error {
+	if strings.Contains(target, "#") {
+		return ERROR_BAD_REQUEST_TARGET
+	}
+	u.RawPath, u.RawQuery, _ = strings.Cut(target, "?")
+	segments := []string{}
+	raw := strings.Split(u.RawPath[1:], "/")
+	for i, seg := range raw {
+		decoded, err := url.PathUnescape(seg)
+		if err != nil || strings.ContainsRune(decoded, 0) {
+			return ERROR_BAD_REQUEST_TARGET
+		}
+		if strings.Contains(decoded, "/") && slices.ContainsFunc(strings.Split(decoded, "/"), isDotSegment) {
+			return ERROR_PATH_TRAVERSAL
+		}
+		last := i == len(raw)-1
+		switch decoded {
+		case ".":
+		case "..":
+			if len(segments) == 0 {
+				return ERROR_PATH_TRAVERSAL
+			}
+			segments = segments[:len(segments)-1]
+		case "":
+			if !last {
+				continue
+			}
+			segments = append(segments, "")
+		default:
+			segments = append(segments, decoded)
+			continue
+		}
+		// a trailing dot-segment leaves a directory, like a trailing slash
+		if last && (len(segments) == 0 || segments[len(segments)-1] != "") {
+			segments = append(segments, "")
+		}
+	}
+	u.Segments = segments
+	u.Path = "/" + strings.Join(segments, "/")
+	return nil
+}
+
+func isDotSegment(s string) bool {
+	return s == "." || s == ".."
+}
+
+// Query returns the decoded query parameters. Malformed pairs are skipped.
+func (r *Request) Query() Query {
+	if r.query == nil {
+		values, _ := url.ParseQuery(r.URL.RawQuery)
+		r.query = Query(values)
+	}
+	return r.query
+}
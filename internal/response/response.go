@@ -2,13 +2,42 @@ package response
 
 import (
 	"fmt"
+	"httpfromtcp/internal/cookie"
 	"httpfromtcp/internal/headers"
 	"io"
 	"strconv"
 )
 
+const (
+	WriterStateStatusLine string = "status-line"
+	WriterStateHeaders    string = "headers"
+	WriterStateBody       string = "body"
+	WriterStateTrailers   string = "trailers"
+	WriterStateDone       string = "done"
+)
+
+var ERROR_WRITE_OUT_OF_ORDER = fmt.Errorf("response written out of order")
+var ERROR_INVALID_STATUS_CODE = fmt.Errorf("status code must have three digits")
+var ERROR_INVALID_REASON_PHRASE = fmt.Errorf("reason phrase contains control characters")
+var ERROR_BODY_NOT_ALLOWED = fmt.Errorf("response status does not allow a body")
+var ERROR_NOT_INTERIM = fmt.Errorf("interim responses must have a 1xx status")
+
+// Writer serialises a response in wire order: status line, headers, body
+// and, for chunked bodies only, trailers. Calls made out of that order fail
+// with ERROR_WRITE_OUT_OF_ORDER without writing anything.
 type Writer struct {
-	writer io.Writer
+	writer    io.Writer
+	state     string
+	version   string
+	status    StatusCode
+	chunked   bool
+	closeConn bool
+	omitBody  bool
+	onHeaders []func(h *headers.Headers)
+	cookies   []*cookie.Cookie
+	// unframed is set when a chunked response goes to an HTTP/1.0 client:
+	// the chunks are sent as is and the connection close ends the body.
+	unframed bool
 }
 
 type Response struct {
@@ -18,71 +47,282 @@ type JsonData struct {
 	Message string `json:"message"`
 }
 
-type StatusCode int
-
-const (
-	StatusOK                  StatusCode = 200
-	StatusBadRequest          StatusCode = 400
-	StatusInternalServerError StatusCode = 500
-)
-
-func GetDefaultHeaders(contentLength int) headers.Headers {
+func GetDefaultHeaders(contentLength int) *headers.Headers {
 	h := headers.NewHeaders()
-	h.Set("Content-length", strconv.Itoa(contentLength))
-	h.Set("Connection", "close")
-	h.Set("Content-type", "text/plain")
+	h.Set("Content-Length", strconv.Itoa(contentLength))
+	h.Set("Content-Type", "text/plain")
 	return h
 }
 
 func NewWriter(w io.Writer) *Writer {
-	return &Writer{writer: w}
+	return &Writer{writer: w, state: WriterStateStatusLine, version: "1.1"}
+}
+
+// SetVersion makes the status line carry the request's HTTP version, "1.0"
+// or "1.1", and adapts the framing to it. The server calls it.
+func (w *Writer) SetVersion(version string) {
+	if version == "1.0" {
+		w.version = version
+	} else {
+		w.version = "1.1"
+	}
 }
 
+func (w *Writer) expect(state, call string) error {
+	if w.state != state {
+		return fmt.Errorf("%w: %s called in state %s", ERROR_WRITE_OUT_OF_ORDER, call, w.state)
+	}
+	return nil
+}
+
+// WriteStatusLine writes the status line with the registered reason phrase.
+// Unregistered codes are sent with an empty one.
 func (w *Writer) WriteStatusLine(s StatusCode) error {
-	statusLine := []byte("")
-	switch s {
-	case StatusOK:
-		statusLine = []byte("HTTP/1.1 200 OK")
-	case StatusBadRequest:
-		statusLine = []byte("HTTP/1.1 400 Bad Request")
-	case StatusInternalServerError:
-		statusLine = []byte("HTTP/1.1 500 Internal Server Error")
-	default:
-		return fmt.Errorf("Unrecognized error code")
-	}
-	statusLine = append(statusLine, "\r\n"...)
-	_, err := w.writer.Write(statusLine)
-	return err
+	return w.WriteStatusLineWithReason(s, StatusText(s))
 }
 
-func (w *Writer) WriteHeaders(h headers.Headers) error {
-	b := []byte{}
-	h.ForEach(func(n, v string) {
-		b = fmt.Appendf(b, "%s: %s\r\n", n, v)
-	})
-	b = fmt.Append(b, "\r\n")
-	_, err := w.writer.Write(b)
+// WriteStatusLineWithReason writes any three-digit status code with a custom
+// reason phrase.
+func (w *Writer) WriteStatusLineWithReason(s StatusCode, reason string) error {
+	if err := w.expect(WriterStateStatusLine, "WriteStatusLine"); err != nil {
+		return err
+	}
+	if s < 100 || s > 999 {
+		return ERROR_INVALID_STATUS_CODE
+	}
+	for _, ch := range []byte(reason) {
+		if ch < ' ' && ch != '\t' || ch == 0x7f {
+			return ERROR_INVALID_REASON_PHRASE
+		}
+	}
+	w.status = s
+	w.state = WriterStateHeaders
+	_, err := w.writer.Write(fmt.Appendf(nil, "HTTP/%s %03d %s\r\n", w.version, int(s), reason))
 	return err
 }
 
+// WriteInterim sends a 1xx informational response, such as 103 Early Hints,
+// ahead of the final one. h may be nil. HTTP/1.0 clients do not understand
+// them, so nothing is sent to those.
+func (w *Writer) WriteInterim(s StatusCode, h *headers.Headers) error {
+	if err := w.expect(WriterStateStatusLine, "WriteInterim"); err != nil {
+		return err
+	}
+	if s < 100 || s > 199 || s == StatusSwitchingProtocols {
+		return ERROR_NOT_INTERIM
+	}
+	if w.version == "1.0" {
+		return nil
+	}
+	if _, err := w.writer.Write(fmt.Appendf(nil, "HTTP/%s %03d %s\r\n", w.version, int(s), StatusText(s))); err != nil {
+		return err
+	}
+	if h == nil {
+		h = headers.NewHeaders()
+	}
+	return w.writeFields(h)
+}
+
+// OmitBody makes the Writer drop the body while still sending the headers
+// describing it, as required when answering HEAD. The server calls it.
+func (w *Writer) OmitBody() {
+	w.omitBody = true
+}
+
+// CloseConnection makes the response announce "Connection: close"; the
+// server then closes the connection once the handler returns.
+func (w *Writer) CloseConnection() {
+	w.closeConn = true
+}
+
+// ClosesConnection reports whether the connection ends after this response,
+// either because the server asked for it or because the handler sent
+// "Connection: close" itself.
+func (w *Writer) ClosesConnection() bool {
+	return w.closeConn
+}
+
+// State reports which part of the response the Writer expects next.
+func (w *Writer) State() string {
+	return w.state
+}
+
+// Status returns the status code written so far, or 0 before the status line.
+func (w *Writer) Status() StatusCode {
+	return w.status
+}
+
+// OnHeaders registers fn to amend the headers right before WriteHeaders
+// sends them, in registration order. Middlewares use it to add fields to
+// responses they do not write themselves.
+func (w *Writer) OnHeaders(fn func(h *headers.Headers)) {
+	w.onHeaders = append(w.onHeaders, fn)
+}
+
+// SetCookie queues c to be sent as its own Set-Cookie field when the headers
+// are written. Invalid cookies are refused with a *cookie.Error.
+func (w *Writer) SetCookie(c *cookie.Cookie) error {
+	if w.state != WriterStateStatusLine && w.state != WriterStateHeaders {
+		return fmt.Errorf("%w: SetCookie called in state %s", ERROR_WRITE_OUT_OF_ORDER, w.state)
+	}
+	if err := c.Valid(); err != nil {
+		return err
+	}
+	w.cookies = append(w.cookies, c)
+	return nil
+}
+
+func (w *Writer) WriteHeaders(h *headers.Headers) error {
+	if err := w.expect(WriterStateHeaders, "WriteHeaders"); err != nil {
+		return err
+	}
+	for _, c := range w.cookies {
+		h.Add("Set-Cookie", c.String())
+	}
+	for _, fn := range w.onHeaders {
+		fn(h)
+	}
+	if w.status < 200 || w.status == StatusNoContent {
+		// RFC 9110 section 8.6 and RFC 9112 section 6.1
+		h.Delete("Content-Length")
+		h.Delete("Transfer-Encoding")
+	}
+	if h.HasToken("Transfer-Encoding", "chunked") {
+		w.chunked = true
+		if w.version == "1.0" {
+			// HTTP/1.0 has no chunked coding; delimit the body by closing
+			h.Delete("Transfer-Encoding")
+			h.Delete("Trailer")
+			w.unframed = true
+			w.closeConn = true
+		}
+	}
+	if _, sized := h.Get("Content-Length"); !sized && !w.chunked && BodyAllowed(w.status) && !w.omitBody {
+		// only closing the connection can tell where this body ends
+		w.closeConn = true
+	}
+	if w.closeConn {
+		h.Set("Connection", "close")
+	} else if h.HasToken("Connection", "close") {
+		w.closeConn = true
+	} else if w.version == "1.0" {
+		h.Set("Connection", "keep-alive")
+	}
+	w.state = WriterStateBody
+	return w.writeFields(h)
+}
+
+// WriteBody writes p verbatim. Chunked responses must use WriteChunkedBody.
 func (w *Writer) WriteBody(p []byte) (int, error) {
+	if err := w.expect(WriterStateBody, "WriteBody"); err != nil {
+		return 0, err
+	}
+	if w.chunked {
+		return 0, fmt.Errorf("%w: WriteBody called on a chunked response", ERROR_WRITE_OUT_OF_ORDER)
+	}
+	if skip, err := w.skipBody(p); skip {
+		if err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
 	return w.writer.Write(p)
 }
 
+// WriteChunkedBody frames p as a single chunk and returns how many bytes of
+// p were written. An empty p writes nothing, since a zero-sized chunk would
+// end the body.
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
-	return 0, nil
+	if err := w.expect(WriterStateBody, "WriteChunkedBody"); err != nil {
+		return 0, err
+	}
+	if !w.chunked {
+		return 0, fmt.Errorf("%w: WriteChunkedBody called without Transfer-Encoding: chunked", ERROR_WRITE_OUT_OF_ORDER)
+	}
+	if skip, err := w.skipBody(p); skip {
+		if err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if w.unframed {
+		return w.writer.Write(p)
+	}
+	chunk := fmt.Appendf(nil, "%x\r\n", len(p))
+	chunk = append(chunk, p...)
+	chunk = append(chunk, "\r\n"...)
+	if _, err := w.writer.Write(chunk); err != nil {
+		return 0, err
+	}
+	return len(p), nil
 }
 
+// WriteChunkedBodyDone writes the last chunk. Trailers may follow through
+// WriteTrailers; otherwise Finish terminates the message.
 func (w *Writer) WriteChunkedBodyDone() (int, error) {
-	return 0, nil
+	if err := w.expect(WriterStateBody, "WriteChunkedBodyDone"); err != nil {
+		return 0, err
+	}
+	if !w.chunked {
+		return 0, fmt.Errorf("%w: WriteChunkedBodyDone called without Transfer-Encoding: chunked", ERROR_WRITE_OUT_OF_ORDER)
+	}
+	w.state = WriterStateTrailers
+	if w.bodyless() || w.unframed {
+		return 0, nil
+	}
+	return w.writer.Write([]byte("0\r\n"))
 }
 
-func (w *Writer) WriteTrailers(h headers.Headers) error {
-	t := []byte{}
+func (w *Writer) WriteTrailers(h *headers.Headers) error {
+	if err := w.expect(WriterStateTrailers, "WriteTrailers"); err != nil {
+		return err
+	}
+	w.state = WriterStateDone
+	if w.bodyless() || w.unframed {
+		return nil
+	}
+	return w.writeFields(h)
+}
+
+// Finish completes a chunked message whose trailers were never written. The
+// server calls it once the handler returns.
+func (w *Writer) Finish() error {
+	if w.state != WriterStateTrailers {
+		return nil
+	}
+	w.state = WriterStateDone
+	if w.bodyless() || w.unframed {
+		return nil
+	}
+	_, err := w.writer.Write([]byte("\r\n"))
+	return err
+}
+
+func (w *Writer) bodyless() bool {
+	return w.omitBody || !BodyAllowed(w.status)
+}
+
+// skipBody reports whether body bytes must not reach the wire: HEAD
+// responses silently drop them, statuses without content reject them.
+func (w *Writer) skipBody(p []byte) (bool, error) {
+	if !BodyAllowed(w.status) {
+		if len(p) > 0 {
+			return true, ERROR_BODY_NOT_ALLOWED
+		}
+		return true, nil
+	}
+	return w.omitBody, nil
+}
+
+func (w *Writer) writeFields(h *headers.Headers) error {
+	b := []byte{}
 	h.ForEach(func(n, v string) {
-		t = fmt.Appendf(t, "%s: %s\r\n", n, v)
+		b = fmt.Appendf(b, "%s: %s\r\n", n, v)
 	})
-	t = fmt.Append(t, "\r\n")
-	_, err := w.writer.Write(t)
+	b = fmt.Append(b, "\r\n")
+	_, err := w.writer.Write(b)
 	return err
 }
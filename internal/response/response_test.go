@@ -0,0 +1,234 @@
+package response
+
+import (
+	"bytes"
+	"httpfromtcp/internal/cookie"
+	"httpfromtcp/internal/headers"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterChunked(t *testing.T) {
+	// Test: Chunked body with trailers
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders(h))
+	n, err := w.WriteChunkedBody([]byte("hello world"))
+	require.NoError(t, err)
+	assert.Equal(t, 11, n)
+	n, err = w.WriteChunkedBody(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Sum", "abc")
+	require.NoError(t, w.WriteTrailers(trailers))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\nb\r\nhello world\r\n0\r\nX-Sum: abc\r\n\r\n", buf.String())
+
+	// Test: Finish terminates a chunked body without trailers
+	buf.Reset()
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", buf.String())
+}
+
+func TestWriterOutOfOrder(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+
+	// Test: Headers before the status line
+	require.ErrorIs(t, w.WriteHeaders(GetDefaultHeaders(0)), ERROR_WRITE_OUT_OF_ORDER)
+	assert.Equal(t, 0, buf.Len())
+
+	// Test: Double status line
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.ErrorIs(t, w.WriteStatusLine(StatusOK), ERROR_WRITE_OUT_OF_ORDER)
+
+	// Test: Chunked writes on a Content-Length response
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(2)))
+	_, err := w.WriteChunkedBody([]byte("hi"))
+	require.ErrorIs(t, err, ERROR_WRITE_OUT_OF_ORDER)
+
+	// Test: Trailers without a chunked body
+	require.ErrorIs(t, w.WriteTrailers(headers.NewHeaders()), ERROR_WRITE_OUT_OF_ORDER)
+	_, err = w.WriteBody([]byte("hi"))
+	require.NoError(t, err)
+	assert.Equal(t, WriterStateBody, w.State())
+}
+
+func TestWriteStatusLine(t *testing.T) {
+	// Test: Registered codes use their reason phrase
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusNotFound))
+	assert.Equal(t, "HTTP/1.1 404 Not Found\r\n", buf.String())
+	assert.Equal(t, "Too Many Requests", StatusText(StatusTooManyRequests))
+
+	// Test: Unregistered codes get an empty reason phrase
+	buf.Reset()
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusCode(599)))
+	assert.Equal(t, "HTTP/1.1 599 \r\n", buf.String())
+
+	// Test: Custom reason phrase
+	buf.Reset()
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLineWithReason(StatusOK, "Totally Fine"))
+	assert.Equal(t, "HTTP/1.1 200 Totally Fine\r\n", buf.String())
+
+	// Test: Invalid codes and reason phrases
+	w = NewWriter(&bytes.Buffer{})
+	require.ErrorIs(t, w.WriteStatusLine(StatusCode(42)), ERROR_INVALID_STATUS_CODE)
+	require.ErrorIs(t, w.WriteStatusLineWithReason(StatusOK, "OK\r\nX-Injected: 1"), ERROR_INVALID_REASON_PHRASE)
+}
+
+func TestWriterBodyRules(t *testing.T) {
+	// Test: 204 drops framing headers and rejects content
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusNoContent))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	assert.NotContains(t, buf.String(), "content-length")
+	_, err := w.WriteBody([]byte("nope"))
+	require.ErrorIs(t, err, ERROR_BODY_NOT_ALLOWED)
+
+	// Test: HEAD responses keep the headers but drop the body
+	buf.Reset()
+	w = NewWriter(buf)
+	w.OmitBody()
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	n, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Contains(t, buf.String(), "Content-Length: 5\r\n")
+	assert.True(t, bytes.HasSuffix(buf.Bytes(), []byte("\r\n\r\n")))
+}
+
+func TestWriterUnsizedBody(t *testing.T) {
+	// Test: A body with no length closes the connection to end it
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	assert.True(t, w.ClosesConnection())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nConnection: close\r\n\r\n", buf.String())
+
+	// Test: Statuses and methods without a body keep the connection
+	for _, status := range []StatusCode{StatusNoContent, StatusNotModified} {
+		w = NewWriter(&bytes.Buffer{})
+		require.NoError(t, w.WriteStatusLine(status))
+		require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+		assert.False(t, w.ClosesConnection(), status)
+	}
+	w = NewWriter(&bytes.Buffer{})
+	w.OmitBody()
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	assert.False(t, w.ClosesConnection())
+}
+
+func TestWriterHTTP10(t *testing.T) {
+	// Test: Kept-alive HTTP/1.0 responses say so
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetVersion("1.0")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.0 200 OK\r\n"))
+	assert.Contains(t, buf.String(), "Connection: keep-alive\r\n")
+	assert.False(t, w.ClosesConnection())
+
+	// Test: Chunked bodies fall back to close-delimited ones
+	buf.Reset()
+	w = NewWriter(buf)
+	w.SetVersion("1.0")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Sum")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteChunkedBody([]byte("hello "))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBody([]byte("world"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Sum", "abc")
+	require.NoError(t, w.WriteTrailers(trailers))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.0 200 OK\r\nConnection: close\r\n\r\nhello world", buf.String())
+	assert.True(t, w.ClosesConnection())
+}
+
+func TestWriteInterim(t *testing.T) {
+	// Test: Interim responses precede the final one
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	h := headers.NewHeaders()
+	h.Set("Link", "</style.css>; rel=preload")
+	require.NoError(t, w.WriteInterim(StatusEarlyHints, h))
+	require.NoError(t, w.WriteInterim(StatusContinue, nil))
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 103 Early Hints\r\nLink: </style.css>; rel=preload\r\n\r\nHTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 200 OK\r\n"))
+
+	// Test: Only 1xx codes other than 101 are interim, and only before the final status
+	require.ErrorIs(t, w.WriteInterim(StatusContinue, nil), ERROR_WRITE_OUT_OF_ORDER)
+	w = NewWriter(buf)
+	require.ErrorIs(t, w.WriteInterim(StatusOK, nil), ERROR_NOT_INTERIM)
+	require.ErrorIs(t, w.WriteInterim(StatusSwitchingProtocols, nil), ERROR_NOT_INTERIM)
+
+	// Test: HTTP/1.0 clients get no interim responses
+	buf.Reset()
+	w = NewWriter(buf)
+	w.SetVersion("1.0")
+	require.NoError(t, w.WriteInterim(StatusEarlyHints, nil))
+	assert.Equal(t, 0, buf.Len())
+}
+
+func TestWriteHeadersOrder(t *testing.T) {
+	// Test: Fields go out in order, with their spelling, Set-Cookie unjoined
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h := GetDefaultHeaders(0)
+	h.Add("Set-Cookie", "a=1")
+	h.Add("Set-Cookie", "b=2")
+	h.Add("X-CamelCase", "kept")
+	require.NoError(t, w.WriteHeaders(h))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\nContent-Type: text/plain\r\nSet-Cookie: a=1\r\nSet-Cookie: b=2\r\nX-CamelCase: kept\r\n\r\n", buf.String())
+}
+
+func TestWriterSetCookie(t *testing.T) {
+	// Test: Each cookie is its own Set-Cookie field
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.SetCookie(&cookie.Cookie{Name: "a", Value: "1", Path: "/", HttpOnly: true}))
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.SetCookie(&cookie.Cookie{Name: "b", Value: "2", SameSite: cookie.SameSiteLax}))
+	h := headers.NewHeaders()
+	h.Set("Content-Length", "0")
+	require.NoError(t, w.WriteHeaders(h))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\nSet-Cookie: a=1; Path=/; HttpOnly\r\nSet-Cookie: b=2; SameSite=Lax\r\n\r\n", buf.String())
+
+	// Test: Too late once the headers are out
+	assert.ErrorIs(t, w.SetCookie(&cookie.Cookie{Name: "c"}), ERROR_WRITE_OUT_OF_ORDER)
+
+	// Test: Invalid cookies are refused
+	w = NewWriter(&bytes.Buffer{})
+	assert.ErrorIs(t, w.SetCookie(&cookie.Cookie{Name: "a", Value: "x;y"}), cookie.ERROR_INVALID_VALUE)
+}
@@ -0,0 +1,50 @@
+package router
+
+import (
+	"httpfromtcp/internal/server"
+	"slices"
+)
+
+// Group registers routes on its Router under a common path prefix, wrapped
+// in the group's middlewares.
+type Group struct {
+	router     *Router
+	prefix     string
+	middleware []server.Middleware
+}
+
+// Use adds middlewares to the routes registered on g from now on.
+func (g *Group) Use(middlewares ...server.Middleware) {
+	g.middleware = append(g.middleware, middlewares...)
+}
+
+func (g *Group) Handle(method, pattern string, handler server.Handler) {
+	g.router.Handle(method, g.prefix+pattern, server.Chain(g.middleware...)(handler))
+}
+
+func (g *Group) Get(pattern string, handler server.Handler) {
+	g.Handle("GET", pattern, handler)
+}
+
+func (g *Group) Post(pattern string, handler server.Handler) {
+	g.Handle("POST", pattern, handler)
+}
+
+func (g *Group) Put(pattern string, handler server.Handler) {
+	g.Handle("PUT", pattern, handler)
+}
+
+func (g *Group) Patch(pattern string, handler server.Handler) {
+	g.Handle("PATCH", pattern, handler)
+}
+
+func (g *Group) Delete(pattern string, handler server.Handler) {
+	g.Handle("DELETE", pattern, handler)
+}
+
+// Group returns a nested group whose prefix and middlewares extend this one.
+func (g *Group) Group(prefix string) *Group {
+	nested := g.router.Group(g.prefix + prefix)
+	nested.middleware = slices.Clone(g.middleware)
+	return nested
+}
@@ -0,0 +1,236 @@
+package router
+
+import (
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Router dispatches requests to handlers by method and path. Patterns are
+// made of "/"-separated segments, each one either literal, a parameter
+// ("{id}") or, in last position only, a wildcard matching the rest of the
+// path ("{path...}" or "*", which is captured as "*"). Literal segments win
+// over parameters, which win over wildcards.
+//
+// Router.ServeRequest is a server.Handler.
+type Router struct {
+	root       *node
+	middleware []server.Middleware
+	// NotFound answers requests no route matches. Defaults to a plain 404.
+	NotFound server.Handler
+}
+
+type node struct {
+	literals     map[string]*node
+	param        *node
+	paramName    string
+	wildcard     *node
+	wildcardName string
+	handlers     map[string]server.Handler
+}
+
+func New() *Router {
+	return &Router{root: &node{}}
+}
+
+// Handle registers handler for method and pattern. It panics on a malformed
+// pattern or a duplicate registration, since both are programming errors.
+func (rt *Router) Handle(method, pattern string, handler server.Handler) {
+	if !strings.HasPrefix(pattern, "/") {
+		panic("router: pattern must start with /: " + pattern)
+	}
+	n := rt.root
+	segments := strings.Split(pattern[1:], "/")
+	for i, seg := range segments {
+		name, kind := parseSegment(seg)
+		switch kind {
+		case segmentWildcard:
+			if i != len(segments)-1 {
+				panic("router: wildcard must be the last segment: " + pattern)
+			}
+			if n.wildcard == nil {
+				n.wildcard = &node{}
+				n.wildcardName = name
+			} else if n.wildcardName != name {
+				panic("router: conflicting wildcard names in " + pattern)
+			}
+			n = n.wildcard
+		case segmentParam:
+			if n.param == nil {
+				n.param = &node{}
+				n.paramName = name
+			} else if n.paramName != name {
+				panic("router: conflicting parameter names in " + pattern)
+			}
+			n = n.param
+		default:
+			if n.literals == nil {
+				n.literals = map[string]*node{}
+			}
+			child, ok := n.literals[seg]
+			if !ok {
+				child = &node{}
+				n.literals[seg] = child
+			}
+			n = child
+		}
+	}
+	if n.handlers == nil {
+		n.handlers = map[string]server.Handler{}
+	}
+	if _, exists := n.handlers[method]; exists {
+		panic("router: duplicate route " + method + " " + pattern)
+	}
+	n.handlers[method] = handler
+}
+
+func (rt *Router) Get(pattern string, handler server.Handler) {
+	rt.Handle("GET", pattern, handler)
+}
+
+func (rt *Router) Post(pattern string, handler server.Handler) {
+	rt.Handle("POST", pattern, handler)
+}
+
+func (rt *Router) Put(pattern string, handler server.Handler) {
+	rt.Handle("PUT", pattern, handler)
+}
+
+func (rt *Router) Patch(pattern string, handler server.Handler) {
+	rt.Handle("PATCH", pattern, handler)
+}
+
+func (rt *Router) Delete(pattern string, handler server.Handler) {
+	rt.Handle("DELETE", pattern, handler)
+}
+
+// Use adds middlewares run on every request reaching the router, including
+// the ones answered with 404 or 405.
+func (rt *Router) Use(middlewares ...server.Middleware) {
+	rt.middleware = append(rt.middleware, middlewares...)
+}
+
+// Group returns a view of the router registering every route under prefix.
+func (rt *Router) Group(prefix string) *Group {
+	return &Group{router: rt, prefix: strings.TrimSuffix(prefix, "/")}
+}
+
+// ServeRequest dispatches req to the matching route, answering 404 when the
+// path is unknown and 405 with an Allow header when only the method is
+// wrong. HEAD requests fall back to the GET handler.
+func (rt *Router) ServeRequest(w *response.Writer, req *request.Request) {
+	server.Chain(rt.middleware...)(rt.dispatch)(w, req)
+}
+
+func (rt *Router) dispatch(w *response.Writer, req *request.Request) {
+	var matches []match
+	if strings.HasPrefix(req.URL.Path, "/") {
+		matches = rt.root.lookup(req.URL.Segments, nil, nil)
+	}
+	if len(matches) == 0 {
+		if rt.NotFound != nil {
+			rt.NotFound(w, req)
+			return
+		}
+		writeStatus(w, response.StatusNotFound, headers.NewHeaders())
+		return
+	}
+
+	method := req.RequestLine.Method
+	allowed := []string{}
+	for _, m := range matches {
+		handler, ok := m.node.handlers[method]
+		if !ok && method == "HEAD" {
+			handler, ok = m.node.handlers["GET"]
+		}
+		if ok {
+			req.PathParams = m.params
+			handler(w, req)
+			return
+		}
+		for method := range m.node.handlers {
+			allowed = append(allowed, method)
+		}
+	}
+	if slices.Contains(allowed, "GET") {
+		allowed = append(allowed, "HEAD")
+	}
+	slices.Sort(allowed)
+	h := headers.NewHeaders()
+	h.Set("Allow", strings.Join(slices.Compact(allowed), ", "))
+	writeStatus(w, response.StatusMethodNotAllowed, h)
+}
+
+type match struct {
+	node   *node
+	params map[string]string
+}
+
+// lookup returns every node with handlers matching segments, most specific
+// first.
+func (n *node) lookup(segments []string, params map[string]string, matches []match) []match {
+	if len(segments) == 0 {
+		if len(n.handlers) > 0 {
+			matches = append(matches, match{node: n, params: params})
+		}
+		if n.wildcard != nil && len(n.wildcard.handlers) > 0 {
+			matches = append(matches, match{node: n.wildcard, params: with(params, n.wildcardName, "")})
+		}
+		return matches
+	}
+	seg, rest := segments[0], segments[1:]
+	if child, ok := n.literals[seg]; ok {
+		matches = child.lookup(rest, params, matches)
+	}
+	if n.param != nil && seg != "" {
+		matches = n.param.lookup(rest, with(params, n.paramName, seg), matches)
+	}
+	if n.wildcard != nil && len(n.wildcard.handlers) > 0 {
+		matches = append(matches, match{node: n.wildcard, params: with(params, n.wildcardName, strings.Join(segments, "/"))})
+	}
+	return matches
+}
+
+// with returns a copy of params with name set, leaving params untouched for
+// the other branches of the lookup.
+func with(params map[string]string, name, value string) map[string]string {
+	out := make(map[string]string, len(params)+1)
+	for k, v := range params {
+		out[k] = v
+	}
+	out[name] = value
+	return out
+}
+
+const (
+	segmentLiteral = iota
+	segmentParam
+	segmentWildcard
+)
+
+func parseSegment(seg string) (string, int) {
+	if seg == "*" {
+		return "*", segmentWildcard
+	}
+	if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") {
+		return seg, segmentLiteral
+	}
+	name := seg[1 : len(seg)-1]
+	if wildcard, ok := strings.CutSuffix(name, "..."); ok {
+		return wildcard, segmentWildcard
+	}
+	return name, segmentParam
+}
+
+func writeStatus(w *response.Writer, status response.StatusCode, h *headers.Headers) {
+	body := []byte(response.StatusText(status) + "\n")
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	h.Set("Content-Type", "text/plain")
+	w.WriteStatusLine(status)
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
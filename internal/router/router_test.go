@@ -0,0 +1,132 @@
+package router
+
+import (
+	"bytes"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(t *testing.T, rt *Router, raw string) string {
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	rt.ServeRequest(response.NewWriter(buf), req)
+	return buf.String()
+}
+
+func echo(name string) func(w *response.Writer, req *request.Request) {
+	return func(w *response.Writer, req *request.Request) {
+		body := []byte(name)
+		for _, p := range []string{"id", "path", "*"} {
+			if v, ok := req.PathParams[p]; ok {
+				body = append(body, " "+p+"="+v...)
+			}
+		}
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	}
+}
+
+func TestRouterMatching(t *testing.T) {
+	rt := New()
+	rt.Get("/users", echo("list"))
+	rt.Get("/users/me", echo("me"))
+	rt.Get("/users/{id}", echo("user"))
+	rt.Post("/users/{id}", echo("update"))
+	rt.Get("/static/{path...}", echo("static"))
+	rt.Get("/files/*", echo("files"))
+	api := rt.Group("/api")
+	api.Group("/v1").Get("/ping", echo("ping"))
+
+	// Test: Literal segments win over parameters
+	assert.True(t, strings.HasSuffix(serve(t, rt, "GET /users/me HTTP/1.1\r\n\r\n"), "me"))
+
+	// Test: Path parameters
+	assert.True(t, strings.HasSuffix(serve(t, rt, "GET /users/42 HTTP/1.1\r\n\r\n"), "user id=42"))
+	assert.True(t, strings.HasSuffix(serve(t, rt, "POST /users/42 HTTP/1.1\r\n\r\n"), "update id=42"))
+
+	// Test: Query strings are ignored for matching
+	assert.True(t, strings.HasSuffix(serve(t, rt, "GET /users?page=2 HTTP/1.1\r\n\r\n"), "list"))
+
+	// Test: Matching uses the decoded, normalised path
+	assert.True(t, strings.HasSuffix(serve(t, rt, "GET //users/./a%20b HTTP/1.1\r\n\r\n"), "user id=a b"))
+	assert.True(t, strings.HasSuffix(serve(t, rt, "GET http://example.com/users/me HTTP/1.1\r\n\r\n"), "me"))
+
+	// Test: An encoded slash does not split a parameter
+	assert.True(t, strings.HasSuffix(serve(t, rt, "GET /users/a%2Fb HTTP/1.1\r\n\r\n"), "user id=a/b"))
+
+	// Test: Wildcards capture the rest of the path
+	assert.True(t, strings.HasSuffix(serve(t, rt, "GET /static/css/site.css HTTP/1.1\r\n\r\n"), "static path=css/site.css"))
+	assert.True(t, strings.HasSuffix(serve(t, rt, "GET /files/a/b HTTP/1.1\r\n\r\n"), "files *=a/b"))
+
+	// Test: Nested groups
+	assert.True(t, strings.HasSuffix(serve(t, rt, "GET /api/v1/ping HTTP/1.1\r\n\r\n"), "ping"))
+
+	// Test: HEAD falls back to GET
+	assert.Contains(t, serve(t, rt, "HEAD /users HTTP/1.1\r\n\r\n"), "HTTP/1.1 200 OK")
+}
+
+func TestRouterErrors(t *testing.T) {
+	rt := New()
+	rt.Get("/users/{id}", echo("user"))
+	rt.Put("/users/{id}", echo("replace"))
+
+	// Test: Unknown path
+	res := serve(t, rt, "GET /nope HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 404 Not Found\r\n"))
+
+	// Test: Known path, wrong method
+	res = serve(t, rt, "DELETE /users/1 HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 405 Method Not Allowed\r\n"))
+	assert.Contains(t, res, "Allow: GET, HEAD, PUT\r\n")
+
+	// Test: Custom NotFound
+	rt.NotFound = echo("custom")
+	assert.True(t, strings.HasSuffix(serve(t, rt, "GET /nope HTTP/1.1\r\n\r\n"), "custom"))
+
+	// Test: Malformed and duplicate patterns
+	assert.Panics(t, func() { rt.Get("users", echo("x")) })
+	assert.Panics(t, func() { rt.Get("/users/{id}", echo("x")) })
+	assert.Panics(t, func() { rt.Get("/a/{rest...}/b", echo("x")) })
+}
+
+func TestRouterMiddleware(t *testing.T) {
+	trace := []string{}
+	tag := func(name string) server.Middleware {
+		return func(next server.Handler) server.Handler {
+			return func(w *response.Writer, req *request.Request) {
+				trace = append(trace, name)
+				next(w, req)
+			}
+		}
+	}
+	rt := New()
+	rt.Use(tag("router"))
+	api := rt.Group("/api")
+	api.Use(tag("api"))
+	admin := api.Group("/admin")
+	admin.Use(tag("admin"))
+	admin.Get("/stats", echo("stats"))
+	api.Get("/ping", echo("ping"))
+
+	// Test: Router, group and nested group middlewares run outermost first
+	serve(t, rt, "GET /api/admin/stats HTTP/1.1\r\n\r\n")
+	assert.Equal(t, []string{"router", "api", "admin"}, trace)
+
+	// Test: Nested group middlewares do not leak into the parent group
+	trace = nil
+	serve(t, rt, "GET /api/ping HTTP/1.1\r\n\r\n")
+	assert.Equal(t, []string{"router", "api"}, trace)
+
+	// Test: Router middlewares also wrap 404s
+	trace = nil
+	serve(t, rt, "GET /missing HTTP/1.1\r\n\r\n")
+	assert.Equal(t, []string{"router"}, trace)
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"crypto/tls"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"log"
+	"net"
+	"time"
+)
+
+// DefaultAddr is where ListenAndServe binds when Config.Addr is empty.
+const DefaultAddr = ":8080"
+
+// Config gathers everything New needs. Options holds the per-connection
+// tuning shared with ServeWithOptions.
+type Config struct {
+	// Addr is the TCP address ListenAndServe binds, e.g. "127.0.0.1:8080"
+	// or ":0" for any free port.
+	Addr string
+	// Listener, when set, is used by ListenAndServe instead of binding Addr.
+	Listener net.Listener
+	Handler  Handler
+	Options
+	// Logger receives the server's own messages. Defaults to log.Default().
+	Logger *log.Logger
+	// TLSConfig, when set, makes the server speak HTTPS on every listener.
+	TLSConfig *tls.Config
+	// Certificates are loaded from disk when serving starts and reloaded
+	// whenever the files change; the one presented is picked by SNI. Setting
+	// any enables HTTPS.
+	Certificates []CertificateFiles
+	// ClientCAFile enables mutual TLS: client certificates must chain to one
+	// of its PEM certificates. ClientAuth defaults to requiring them.
+	ClientCAFile string
+	ClientAuth   tls.ClientAuthType
+	// OnConnState is called whenever a connection changes state, with one of
+	// the ConnState* constants. It must not block.
+	OnConnState func(conn net.Conn, state string)
+}
+
+// Option adjusts a Config before New builds the server from it.
+type Option func(*Config)
+
+func WithAddr(addr string) Option {
+	return func(c *Config) { c.Addr = addr }
+}
+
+func WithListener(l net.Listener) Option {
+	return func(c *Config) { c.Listener = l }
+}
+
+func WithHandler(h Handler) Option {
+	return func(c *Config) { c.Handler = h }
+}
+
+// WithOptions replaces all the per-connection tuning at once.
+func WithOptions(o Options) Option {
+	return func(c *Config) { c.Options = o }
+}
+
+// WithTimeouts sets the read header, read, write and idle timeouts; see
+// Options for their meaning.
+func WithTimeouts(readHeader, read, write, idle time.Duration) Option {
+	return func(c *Config) {
+		c.ReadHeaderTimeout = readHeader
+		c.ReadTimeout = read
+		c.WriteTimeout = write
+		c.IdleTimeout = idle
+	}
+}
+
+func WithParseOptions(p request.ParseOptions) Option {
+	return func(c *Config) { c.ParseOptions = p }
+}
+
+func WithMaxRequestsPerConn(n int) Option {
+	return func(c *Config) { c.MaxRequestsPerConn = n }
+}
+
+// WithMiddleware appends middlewares wrapping every request.
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(c *Config) { c.Middleware = append(c.Middleware, middlewares...) }
+}
+
+func WithErrorRenderer(render ErrorRenderer) Option {
+	return func(c *Config) { c.ErrorRenderer = render }
+}
+
+func WithLogger(l *log.Logger) Option {
+	return func(c *Config) { c.Logger = l }
+}
+
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(c *Config) { c.TLSConfig = tlsConfig }
+}
+
+// WithCertificate adds a certificate served over HTTPS. Call it once per
+// host name to serve several certificates selected by SNI.
+func WithCertificate(certFile, keyFile string) Option {
+	return func(c *Config) {
+		c.Certificates = append(c.Certificates, CertificateFiles{CertFile: certFile, KeyFile: keyFile})
+	}
+}
+
+// WithClientAuth enables mutual TLS against the CAs in caFile.
+func WithClientAuth(caFile string, mode tls.ClientAuthType) Option {
+	return func(c *Config) {
+		c.ClientCAFile = caFile
+		c.ClientAuth = mode
+	}
+}
+
+func WithConnStateHook(fn func(conn net.Conn, state string)) Option {
+	return func(c *Config) { c.OnConnState = fn }
+}
+
+// New builds a server from opts. Nothing is bound until ListenAndServe or
+// Serve is called.
+func New(opts ...Option) *Server {
+	c := Config{}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return NewWithConfig(c)
+}
+
+func NewWithConfig(c Config) *Server {
+	if c.Addr == "" {
+		c.Addr = DefaultAddr
+	}
+	if c.Handler == nil {
+		c.Handler = func(w *response.Writer, req *request.Request) {
+			writeError(w, response.StatusNotFound, "text/plain", []byte(response.StatusText(response.StatusNotFound)+"\n"))
+		}
+	}
+	if c.Logger == nil {
+		c.Logger = log.Default()
+	}
+	c.Options = c.Options.withDefaults()
+	return &Server{
+		config:  c,
+		options: c.Options,
+		handler: Chain(c.Middleware...)(c.Handler),
+		conns:   map[net.Conn]string{},
+	}
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/negotiate"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+)
+
+// HandlerError is an error carrying the status code and message the client
+// should see.
+type HandlerError struct {
+	StatusCode response.StatusCode
+	Message    string
+}
+
+func (e *HandlerError) Error() string {
+	return fmt.Sprintf("%d %s", e.StatusCode, e.Message)
+}
+
+// ErrorHandler is a Handler that may fail instead of writing an error
+// response itself. Wrap it with HandleErrors.
+type ErrorHandler func(w *response.Writer, req *request.Request) error
+
+// ErrorRenderer writes herr as a complete response.
+type ErrorRenderer func(w *response.Writer, req *request.Request, herr *HandlerError)
+
+type errorRendererKey struct{}
+
+// HandleErrors adapts h to a Handler. A returned *HandlerError is rendered
+// with the server's ErrorRenderer; a read timeout on the request body becomes
+// a 408, a body over its limit a 413, a malformed chunked or form body a 400,
+// negotiate.ERROR_NOT_ACCEPTABLE a 406 and any other error a 500 whose
+// message does not leak the error text. After a body error the rest of the
+// request can no longer be framed, so the connection is closed. If h already
+// started the response nothing more is written and the connection is closed
+// instead, since the client cannot tell a truncated body from a complete one.
+func HandleErrors(h ErrorHandler) Handler {
+	return func(w *response.Writer, req *request.Request) {
+		err := h(w, req)
+		if err == nil {
+			return
+		}
+		if w.State() != response.WriterStateStatusLine {
+			w.CloseConnection()
+			return
+		}
+		var herr *HandlerError
+		if isTimeout(err) {
+			w.CloseConnection()
+			herr = &HandlerError{
+				StatusCode: response.StatusRequestTimeout,
+				Message:    response.StatusText(response.StatusRequestTimeout),
+			}
+		} else if status, ok := bodyErrorStatus(err); ok {
+			w.CloseConnection()
+			herr = &HandlerError{StatusCode: status, Message: response.StatusText(status)}
+		} else if errors.Is(err, negotiate.ERROR_NOT_ACCEPTABLE) {
+			herr = &HandlerError{
+				StatusCode: response.StatusNotAcceptable,
+				Message:    response.StatusText(response.StatusNotAcceptable),
+			}
+		} else if !errors.As(err, &herr) {
+			herr = &HandlerError{
+				StatusCode: response.StatusInternalServerError,
+				Message:    response.StatusText(response.StatusInternalServerError),
+			}
+		}
+		render, ok := req.Context().Value(errorRendererKey{}).(ErrorRenderer)
+		if !ok {
+			render = RenderError
+		}
+		render(w, req, herr)
+	}
+}
+
+// bodyErrorStatus picks the status code for an error reading or parsing the
+// request body, reporting false for errors that did not come from the body.
+func bodyErrorStatus(err error) (response.StatusCode, bool) {
+	var limitErr *request.LimitError
+	var fieldErr *headers.FieldError
+	switch {
+	case errors.Is(err, request.ERROR_FORM_TOO_LARGE):
+		return response.StatusRequestEntityTooLarge, true
+	case errors.As(err, &limitErr):
+		// trailers share the header limits
+		return parseErrorStatus(err), true
+	case errors.Is(err, request.ERROR_BAD_CHUNK_SIZE), errors.Is(err, request.ERROR_BAD_CHUNK_DATA),
+		errors.Is(err, request.ERROR_MALFORMED_FORM), errors.As(err, &fieldErr):
+		return response.StatusBadRequest, true
+	}
+	return 0, false
+}
+
+func withErrorRenderer(ctx context.Context, render ErrorRenderer) context.Context {
+	return context.WithValue(ctx, errorRendererKey{}, render)
+}
+
+// RenderError is the default ErrorRenderer. It answers with problem+json,
+// HTML or plain text, whichever the Accept header prefers, and plain text
+// when it accepts none of them.
+func RenderError(w *response.Writer, req *request.Request, herr *HandlerError) {
+	contentType, _ := negotiate.ContentType(req, "text/plain", "application/problem+json", "application/json", "text/html")
+	switch contentType {
+	case "application/problem+json", "application/json":
+		RenderProblemJSON(w, req, herr)
+	case "text/html":
+		RenderHTML(w, req, herr)
+	default:
+		RenderText(w, req, herr)
+	}
+}
+
+// RenderText answers with a text/plain body holding the status and message.
+func RenderText(w *response.Writer, req *request.Request, herr *HandlerError) {
+	body := fmt.Sprintf("%d %s\n", herr.StatusCode, herr.Message)
+	writeError(w, herr.StatusCode, "text/plain", []byte(body))
+}
+
+// RenderHTML answers with a minimal HTML page.
+func RenderHTML(w *response.Writer, req *request.Request, herr *HandlerError) {
+	title := html.EscapeString(fmt.Sprintf("%d %s", herr.StatusCode, response.StatusText(herr.StatusCode)))
+	body := fmt.Sprintf(`<html>
+  <head>
+    <title>%s</title>
+  </head>
+  <body>
+    <h1>%s</h1>
+    <p>%s</p>
+  </body>
+</html>`, title, title, html.EscapeString(herr.Message))
+	writeError(w, herr.StatusCode, "text/html", []byte(body))
+}
+
+// problem is the RFC 9457 problem details object.
+type problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// RenderProblemJSON answers with an application/problem+json document
+// (RFC 9457).
+func RenderProblemJSON(w *response.Writer, req *request.Request, herr *HandlerError) {
+	body, err := json.Marshal(problem{
+		Type:     "about:blank",
+		Title:    response.StatusText(herr.StatusCode),
+		Status:   int(herr.StatusCode),
+		Detail:   herr.Message,
+		Instance: req.RequestLine.RequestTarget,
+	})
+	if err != nil {
+		RenderText(w, req, herr)
+		return
+	}
+	writeError(w, herr.StatusCode, "application/problem+json", body)
+}
+
+func writeError(w *response.Writer, status response.StatusCode, contentType string, body []byte) {
+	h := response.GetDefaultHeaders(len(body))
+	h.Set("Content-Type", contentType)
+	w.WriteStatusLine(status)
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
@@ -0,0 +1,16 @@
+package server
+
+// Middleware wraps a Handler with cross-cutting behaviour such as logging
+// or authentication.
+type Middleware func(Handler) Handler
+
+// Chain composes middlewares so that the first one is the outermost:
+// Chain(a, b)(h) runs a, then b, then h.
+func Chain(middlewares ...Middleware) Middleware {
+	return func(h Handler) Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			h = middlewares[i](h)
+		}
+		return h
+	}
+}
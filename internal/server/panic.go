@@ -0,0 +1,60 @@
+package server
+
+import (
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"runtime/debug"
+)
+
+// PanicInfo describes a panic recovered while serving a connection.
+// RequestLine is zero when the panic happened before a request was parsed.
+type PanicInfo struct {
+	Value       any
+	Stack       []byte
+	RequestLine request.RequestLine
+}
+
+// OnPanic registers fn to be called, after logging, with every panic the
+// server recovers from, e.g. to forward it to an error tracker.
+func (s *Server) OnPanic(fn func(PanicInfo)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onPanic = fn
+}
+
+func (s *Server) reportPanic(value any, rl request.RequestLine) {
+	info := PanicInfo{Value: value, Stack: debug.Stack(), RequestLine: rl}
+	if rl.Method != "" {
+		s.config.Logger.Printf("panic serving %s %s: %v\n%s", rl.Method, rl.RequestTarget, value, info.Stack)
+	} else {
+		s.config.Logger.Printf("panic reading request: %v\n%s", value, info.Stack)
+	}
+	s.mu.Lock()
+	fn := s.onPanic
+	s.mu.Unlock()
+	if fn != nil {
+		fn(info)
+	}
+}
+
+// runHandler calls the handler, isolating the rest of the process from its
+// panics. It reports false when the handler panicked, in which case the
+// client got a 500 if the response had not started and the connection must
+// be dropped either way.
+func (s *Server) runHandler(w *response.Writer, r *request.Request) (ok bool) {
+	defer func() {
+		rec := recover()
+		if rec == nil {
+			return
+		}
+		ok = false
+		s.reportPanic(rec, r.RequestLine)
+		if w.State() == response.WriterStateStatusLine {
+			w.CloseConnection()
+			w.WriteStatusLine(response.StatusInternalServerError)
+			w.WriteHeaders(response.GetDefaultHeaders(0))
+		}
+	}()
+	s.handler(w, r)
+	return true
+}
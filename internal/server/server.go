@@ -1,62 +1,337 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"httpfromtcp/internal/headers"
 	"httpfromtcp/internal/request"
 	"httpfromtcp/internal/response"
+	"io"
 	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-type Server struct {
-	closed   bool
-	state    string
-	handler  Handler
-	listener net.Listener
+const (
+	DefaultIdleTimeout        = 60 * time.Second
+	DefaultReadHeaderTimeout  = 10 * time.Second
+	DefaultMinBodyRate        = 128
+	DefaultMinBodyRateGrace   = 5 * time.Second
+	DefaultMaxRequestsPerConn = 1000
+)
+
+// Options tunes how connections are served. Zero fields use the defaults;
+// a negative duration, MinBodyRate or MaxRequestsPerConn removes that bound.
+type Options struct {
+	// IdleTimeout bounds how long a kept-alive connection may wait for the
+	// next request.
+	IdleTimeout time.Duration
+	// ReadHeaderTimeout bounds reading the request line and headers, counted
+	// from their first byte. A new connection also gets this long to start
+	// sending its first request.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout bounds reading a whole request, body included, counted from
+	// its first byte. Zero means no limit.
+	ReadTimeout time.Duration
+	// WriteTimeout bounds writing the response, counted from the end of the
+	// request headers. Zero means no limit.
+	WriteTimeout time.Duration
+	// MinBodyRate is the slowest average upload rate tolerated for request
+	// bodies, in bytes per second, once MinBodyRateGrace has passed. With no
+	// ReadTimeout it is all that stops a client trickling a body forever.
+	MinBodyRate      int
+	MinBodyRateGrace time.Duration
+	// MaxRequestsPerConn is how many requests are served on one connection
+	// before it is closed.
+	MaxRequestsPerConn int
+	ParseOptions       request.ParseOptions
+	// Middleware wraps the handler of every request, first one outermost.
+	Middleware []Middleware
+	// ErrorRenderer writes the errors returned through HandleErrors.
+	// Defaults to RenderError.
+	ErrorRenderer ErrorRenderer
 }
 
-type HandlerError struct {
-	StatusCode response.StatusCode
-	Message    string
+var ERROR_SERVER_CLOSED = fmt.Errorf("server closed")
+
+type Server struct {
+	closed  atomic.Bool
+	state   string
+	config  Config
+	handler Handler
+	options Options
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]string
+	onPanic  func(PanicInfo)
 }
 
 type Handler func(w *response.Writer, req *request.Request)
 
+// Serve binds port on every interface and serves handler in the background.
+// It predates New and is kept for simple programs.
 func Serve(port uint16, handler Handler) (*Server, error) {
+	return ServeWithOptions(port, handler, Options{})
+}
+
+func ServeWithOptions(port uint16, handler Handler, options Options) (*Server, error) {
 	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return nil, err
 	}
-	s := &Server{closed: false, handler: handler, listener: l}
-	go s.listen()
+	s := New(WithHandler(handler), WithOptions(options))
+	go s.Serve(l)
 	return s, nil
 }
 
-func (s *Server) listen() {
+// ListenAndServe binds Config.Addr, or uses Config.Listener, and serves
+// until the server is closed. It always returns a non-nil error,
+// ERROR_SERVER_CLOSED after Close or Shutdown.
+func (s *Server) ListenAndServe() error {
+	return s.listenAndServe(s.config)
+}
+
+func (s *Server) listenAndServe(c Config) error {
+	if s.closed.Load() {
+		return ERROR_SERVER_CLOSED
+	}
+	l := c.Listener
+	if l == nil {
+		var err error
+		l, err = net.Listen("tcp", c.Addr)
+		if err != nil {
+			return err
+		}
+	}
+	return s.serve(l, c)
+}
+
+// Serve accepts connections on l until the server is closed, then returns
+// ERROR_SERVER_CLOSED. Any other accept error is returned as is. l is
+// wrapped in TLS when Config.TLSConfig or Config.Certificates is set.
+func (s *Server) Serve(l net.Listener) error {
+	return s.serve(l, s.config)
+}
+
+// serve is Serve with the TLS settings taken from c, which may differ from
+// the server's own config.
+func (s *Server) serve(l net.Listener, c Config) error {
+	tlsConfig, reloader, err := buildTLSConfig(c)
+	if err != nil {
+		l.Close()
+		return err
+	}
+	if reloader != nil {
+		if err := reloader.load(); err != nil {
+			l.Close()
+			return err
+		}
+	}
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	}
+	s.mu.Lock()
+	if s.closed.Load() {
+		s.mu.Unlock()
+		l.Close()
+		return ERROR_SERVER_CLOSED
+	}
+	s.listener = l
+	s.mu.Unlock()
 	for {
-		conn, err := s.listener.Accept()
-		if s.closed {
-			return
+		conn, err := l.Accept()
+		if s.closed.Load() {
+			if conn != nil {
+				conn.Close()
+			}
+			return ERROR_SERVER_CLOSED
 		}
 		if err != nil {
-			return
+			return err
+		}
+		if !s.trackConn(conn) {
+			conn.Close()
+			continue
 		}
 		go s.handle(conn)
 	}
 }
 
-func (s *Server) Close() error {
-	s.closed = true
-	return nil
+// Addr returns the address the server listens on, or nil before Serve
+// started. With Config.Addr ":0" this is how to learn the chosen port.
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+func (o Options) withDefaults() Options {
+	if o.IdleTimeout == 0 {
+		o.IdleTimeout = DefaultIdleTimeout
+	}
+	if o.ReadHeaderTimeout == 0 {
+		o.ReadHeaderTimeout = DefaultReadHeaderTimeout
+	}
+	if o.MinBodyRate == 0 {
+		o.MinBodyRate = DefaultMinBodyRate
+	}
+	if o.MinBodyRateGrace == 0 {
+		o.MinBodyRateGrace = DefaultMinBodyRateGrace
+	}
+	if o.MaxRequestsPerConn == 0 {
+		o.MaxRequestsPerConn = DefaultMaxRequestsPerConn
+	}
+	if o.ErrorRenderer == nil {
+		o.ErrorRenderer = RenderError
+	}
+	return o
 }
 
+// handle serves requests from conn until either side asks to close it, the
+// connection stays idle too long or the per-connection request cap is hit.
 func (s *Server) handle(conn net.Conn) {
+	defer s.untrackConn(conn)
 	defer conn.Close()
-	responseWriter := response.NewWriter(conn)
-	r, err := request.RequestFromReader(conn)
-	if err != nil {
-		responseWriter.WriteStatusLine(response.StatusBadRequest)
-		responseWriter.WriteHeaders(response.GetDefaultHeaders(0))
-		return
+	defer func() {
+		// handler panics are caught closer to the handler; this only guards
+		// the parser and the connection bookkeeping
+		if rec := recover(); rec != nil {
+			s.reportPanic(rec, request.RequestLine{})
+		}
+	}()
+	guard := &deadlineReader{conn: conn, rate: s.options.MinBodyRate, grace: s.options.MinBodyRateGrace}
+	reader := request.NewReader(guard, s.options.ParseOptions)
+	ctx := withErrorRenderer(context.Background(), s.options.ErrorRenderer)
+	for served := 0; ; served++ {
+		wait := s.options.IdleTimeout
+		if served == 0 {
+			wait = s.options.ReadHeaderTimeout
+		}
+		guard.waitFor(wait)
+		conn.SetWriteDeadline(time.Time{})
+		if !s.setConnState(conn, ConnStateIdle) {
+			return
+		}
+		if err := reader.Peek(); err != nil {
+			return
+		}
+		s.setConnState(conn, ConnStateActive)
+
+		requestStart := time.Now()
+		guard.waitFor(s.options.ReadHeaderTimeout)
+		r, err := reader.ReadRequest()
+		if err != nil {
+			if !isConnGone(err) {
+				s.config.Logger.Printf("rejecting request from %s: %v", conn.RemoteAddr(), err)
+				conn.SetWriteDeadline(after(s.options.WriteTimeout))
+				responseWriter := response.NewWriter(conn)
+				responseWriter.CloseConnection()
+				responseWriter.WriteStatusLine(parseErrorStatus(err))
+				responseWriter.WriteHeaders(response.GetDefaultHeaders(0))
+			}
+			return
+		}
+		hardDeadline := time.Time{}
+		if s.options.ReadTimeout > 0 {
+			hardDeadline = requestStart.Add(s.options.ReadTimeout)
+		}
+		if tlsConn, ok := conn.(*tls.Conn); ok {
+			state := tlsConn.ConnectionState()
+			r.TLS = &state
+		}
+		guard.startBody(hardDeadline)
+		conn.SetWriteDeadline(after(s.options.WriteTimeout))
+
+		responseWriter := response.NewWriter(conn)
+		responseWriter.SetVersion(r.RequestLine.HttpVersion)
+		lastAllowed := s.options.MaxRequestsPerConn > 0 && served+1 >= s.options.MaxRequestsPerConn
+		if !r.KeepAlive() || lastAllowed || s.closed.Load() {
+			responseWriter.CloseConnection()
+		}
+		if r.RequestLine.Method == "HEAD" {
+			responseWriter.OmitBody()
+		}
+		if expect, ok := r.Headers.Get("expect"); ok && r.RequestLine.ProtoAtLeast(1, 1) && !strings.EqualFold(expect, "100-continue") {
+			responseWriter.CloseConnection()
+			responseWriter.WriteStatusLine(response.StatusExpectationFailed)
+			responseWriter.WriteHeaders(response.GetDefaultHeaders(0))
+			return
+		}
+		if r.ExpectsContinue() {
+			expectContinue(responseWriter, r)
+		}
+		req := r.WithContext(ctx)
+		ok := s.runHandler(responseWriter, req)
+		req.RemoveForm()
+		if !ok {
+			return
+		}
+		// answer for a handler that stopped short of the headers, so the
+		// client is not left waiting on a kept-alive connection
+		if responseWriter.State() == response.WriterStateStatusLine {
+			responseWriter.WriteStatusLine(response.StatusOK)
+		}
+		if responseWriter.State() == response.WriterStateHeaders {
+			responseWriter.WriteHeaders(response.GetDefaultHeaders(0))
+		}
+		responseWriter.Finish()
+		r.BodyReader.Close()
+		if responseWriter.ClosesConnection() {
+			return
+		}
+	}
+}
+
+// expectContinue sends 100 Continue when the handler starts reading the body.
+// A handler answering without reading it, say with 413 or 417, gets the
+// connection closed instead, since the client may never send the body.
+func expectContinue(w *response.Writer, r *request.Request) {
+	continued := false
+	r.OnBodyRead(func() error {
+		if w.State() != response.WriterStateStatusLine {
+			return nil
+		}
+		continued = true
+		return w.WriteInterim(response.StatusContinue, nil)
+	})
+	w.OnHeaders(func(*headers.Headers) {
+		if !continued {
+			w.CloseConnection()
+		}
+	})
+}
+
+// isConnGone reports whether a ReadRequest error means there is nobody left
+// to answer: the client hung up, the server closed the connection, or the
+// previous body could not be skipped.
+func isConnGone(err error) bool {
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, request.ERROR_BODY_NOT_CONSUMED)
+}
+
+// parseErrorStatus picks the status code answering a request that could not
+// be parsed.
+func parseErrorStatus(err error) response.StatusCode {
+	switch {
+	case isTimeout(err):
+		return response.StatusRequestTimeout
+	case errors.Is(err, request.ERROR_HTTP_VERSION_NOT_SUPPORTED):
+		return response.StatusHTTPVersionNotSupported
+	case errors.Is(err, request.ERROR_REQUEST_LINE_TOO_LONG):
+		return response.StatusURITooLong
+	case errors.Is(err, request.ERROR_HEADERS_TOO_LARGE), errors.Is(err, request.ERROR_TOO_MANY_HEADERS):
+		return response.StatusRequestHeaderFieldsTooLarge
+	case errors.Is(err, request.ERROR_BODY_TOO_LARGE):
+		return response.StatusRequestEntityTooLarge
 	}
-	s.handler(responseWriter, r)
+	return response.StatusBadRequest
 }
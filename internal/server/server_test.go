@@ -1 +1,657 @@
 package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/negotiate"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseErrorStatus(t *testing.T) {
+	assert.Equal(t, response.StatusBadRequest, parseErrorStatus(request.ERROR_BAD_REQUEST_LINE))
+	assert.Equal(t, response.StatusURITooLong, parseErrorStatus(&request.LimitError{Err: request.ERROR_REQUEST_LINE_TOO_LONG}))
+	assert.Equal(t, response.StatusRequestHeaderFieldsTooLarge, parseErrorStatus(errors.Join(errors.New("error while parsing data"), &request.LimitError{Err: request.ERROR_TOO_MANY_HEADERS})))
+	assert.Equal(t, response.StatusRequestEntityTooLarge, parseErrorStatus(&request.LimitError{Err: request.ERROR_BODY_TOO_LARGE}))
+}
+
+func startTestServer(t *testing.T, handler Handler, options Options) (*Server, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := New(WithHandler(handler), WithOptions(options))
+	go s.Serve(l)
+	require.Eventually(t, func() bool { return s.Addr() != nil }, time.Second, time.Millisecond)
+	t.Cleanup(func() { s.Close() })
+	return s, l.Addr().String()
+}
+
+func okHandler(w *response.Writer, req *request.Request) {
+	body := []byte(req.RequestLine.RequestTarget)
+	w.WriteStatusLine(response.StatusOK)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func TestKeepAlive(t *testing.T) {
+	_, addr := startTestServer(t, okHandler, Options{})
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+
+	// Test: Pipelined requests are answered in order on one connection
+	_, err = conn.Write([]byte("GET /one HTTP/1.1\r\nHost: x\r\n\r\nGET /two HTTP/1.1\r\nHost: x\r\n\r\n"))
+	require.NoError(t, err)
+	for _, target := range []string{"/one", "/two"} {
+		res, err := http.ReadResponse(br, nil)
+		require.NoError(t, err)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Equal(t, target, string(body))
+		assert.False(t, res.Close)
+	}
+
+	// Test: Connection: close ends the connection after the response
+	_, err = conn.Write([]byte("GET /three HTTP/1.1\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	res, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	assert.True(t, res.Close)
+	io.ReadAll(res.Body)
+	_, err = br.ReadByte()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestUnframedResponses(t *testing.T) {
+	_, addr := startTestServer(t, func(w *response.Writer, req *request.Request) {
+		switch req.RequestLine.RequestTarget {
+		case "/silent":
+		case "/status-only":
+			w.WriteStatusLine(response.StatusAccepted)
+		case "/unsized":
+			w.WriteStatusLine(response.StatusOK)
+			w.WriteHeaders(headers.NewHeaders())
+			w.WriteBody([]byte("until close"))
+		}
+	}, Options{})
+	exchange := func(target string) (*http.Response, string, *bufio.Reader) {
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, err = conn.Write([]byte("GET " + target + " HTTP/1.1\r\nHost: x\r\n\r\n"))
+		require.NoError(t, err)
+		br := bufio.NewReader(conn)
+		res, err := http.ReadResponse(br, nil)
+		require.NoError(t, err)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, string(body), br
+	}
+
+	// Test: A handler writing nothing gets an empty 200 and keeps the connection
+	res, body, _ := exchange("/silent")
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, int64(0), res.ContentLength)
+	assert.Empty(t, body)
+	assert.False(t, res.Close)
+
+	// Test: A handler stopping after the status line gets default headers
+	res, _, _ = exchange("/status-only")
+	assert.Equal(t, 202, res.StatusCode)
+	assert.Equal(t, int64(0), res.ContentLength)
+
+	// Test: A body without Content-Length or chunked ends with the connection
+	res, body, br := exchange("/unsized")
+	assert.True(t, res.Close)
+	assert.Equal(t, "until close", body)
+	_, err := br.ReadByte()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestMaxRequestsPerConn(t *testing.T) {
+	_, addr := startTestServer(t, okHandler, Options{MaxRequestsPerConn: 2})
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+
+	_, err = conn.Write([]byte("GET /1 HTTP/1.1\r\n\r\nGET /2 HTTP/1.1\r\n\r\nGET /3 HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	res, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	assert.False(t, res.Close)
+	io.ReadAll(res.Body)
+	res, err = http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	assert.True(t, res.Close)
+	io.ReadAll(res.Body)
+	_, err = br.ReadByte()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestIdleTimeout(t *testing.T) {
+	_, addr := startTestServer(t, okHandler, Options{IdleTimeout: 50 * time.Millisecond})
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	res, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	io.ReadAll(res.Body)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = br.ReadByte()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestHTTPVersions(t *testing.T) {
+	_, addr := startTestServer(t, okHandler, Options{})
+
+	// Test: HTTP/1.0 is answered in kind and closed by default
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /old HTTP/1.0\r\n\r\n"))
+	require.NoError(t, err)
+	raw, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(raw), "HTTP/1.0 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(string(raw), "\r\n\r\n/old"))
+
+	// Test: HTTP/1.0 keep-alive keeps the connection open
+	conn2, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn2.Close()
+	br := bufio.NewReader(conn2)
+	for i := 0; i < 2; i++ {
+		_, err = conn2.Write([]byte("GET / HTTP/1.0\r\nConnection: keep-alive\r\n\r\n"))
+		require.NoError(t, err)
+		res, err := http.ReadResponse(br, nil)
+		require.NoError(t, err)
+		io.ReadAll(res.Body)
+		assert.Equal(t, 0, res.ProtoMinor)
+		assert.Equal(t, "keep-alive", res.Header.Get("Connection"))
+	}
+
+	// Test: HTTP/2 on the plaintext port gets a 505
+	conn3, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn3.Close()
+	_, err = conn3.Write([]byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"))
+	require.NoError(t, err)
+	res, err := http.ReadResponse(bufio.NewReader(conn3), nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusHTTPVersionNotSupported, res.StatusCode)
+}
+
+func TestClose(t *testing.T) {
+	s, addr := startTestServer(t, okHandler, Options{})
+	require.NoError(t, s.Close())
+
+	// Test: The port is released
+	l, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+	l.Close()
+}
+
+func TestShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s, addr := startTestServer(t, func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/slow" {
+			close(started)
+			<-release
+		}
+		okHandler(w, req)
+	}, Options{})
+
+	idle, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer idle.Close()
+	busy, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer busy.Close()
+	_, err = busy.Write([]byte("GET /slow HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	<-started
+
+	// Test: In-flight requests are answered before Shutdown returns
+	done := make(chan error)
+	go func() { done <- s.Shutdown(context.Background()) }()
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("Shutdown returned with a request in flight")
+	default:
+	}
+	close(release)
+	require.NoError(t, <-done)
+	br := bufio.NewReader(busy)
+	res, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	io.ReadAll(res.Body)
+	_, err = br.ReadByte()
+	assert.Equal(t, io.EOF, err)
+
+	// Test: Idle connections are closed
+	idle.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = idle.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	s, addr := startTestServer(t, func(w *response.Writer, req *request.Request) {
+		close(started)
+		<-release
+	}, Options{})
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	<-started
+
+	// Test: Busy connections are force-closed once the context expires
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func serveErrorHandler(t *testing.T, h ErrorHandler, raw string) string {
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	HandleErrors(h)(response.NewWriter(buf), req)
+	return buf.String()
+}
+
+func TestHandleErrors(t *testing.T) {
+	notFound := func(w *response.Writer, req *request.Request) error {
+		return &HandlerError{StatusCode: response.StatusNotFound, Message: "no such <user>"}
+	}
+
+	// Test: Plain text by default
+	res := serveErrorHandler(t, notFound, "GET /users/1 HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 404 Not Found\r\n"))
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\n404 no such <user>\n"))
+
+	// Test: problem+json for API clients
+	res = serveErrorHandler(t, notFound, "GET /users/1 HTTP/1.1\r\nAccept: application/json\r\n\r\n")
+	assert.Contains(t, res, "Content-Type: application/problem+json\r\n")
+	assert.Contains(t, res, `{"type":"about:blank","title":"Not Found","status":404,"detail":"no such \u003cuser\u003e","instance":"/users/1"}`)
+
+	// Test: Escaped HTML for browsers, skipping ranges with q=0
+	res = serveErrorHandler(t, notFound, "GET /users/1 HTTP/1.1\r\nAccept: application/json;q=0, text/html\r\n\r\n")
+	assert.Contains(t, res, "Content-Type: text/html\r\n")
+	assert.Contains(t, res, "<p>no such &lt;user&gt;</p>")
+
+	// Test: The highest q wins over the order ranges were sent in
+	res = serveErrorHandler(t, notFound, "GET /users/1 HTTP/1.1\r\nAccept: text/html;q=0.5, application/problem+json\r\n\r\n")
+	assert.Contains(t, res, "Content-Type: application/problem+json\r\n")
+
+	// Test: Failed negotiation becomes a 406
+	res = serveErrorHandler(t, func(w *response.Writer, req *request.Request) error {
+		_, err := negotiate.ContentType(req, "application/json")
+		return err
+	}, "GET / HTTP/1.1\r\nAccept: text/html\r\n\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 406 Not Acceptable\r\n"))
+
+	// Test: Body errors close the connection, since the stream is out of sync
+	readBody := func(w *response.Writer, req *request.Request) error {
+		_, err := io.ReadAll(req.BodyReader)
+		return err
+	}
+	res = serveErrorHandler(t, readBody, "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 400 Bad Request\r\n"))
+	assert.Contains(t, res, "Connection: close\r\n")
+	res = serveErrorHandler(t, func(w *response.Writer, req *request.Request) error {
+		return &request.LimitError{Err: request.ERROR_BODY_TOO_LARGE, Limit: 10}
+	}, "POST / HTTP/1.1\r\nContent-Length: 20\r\n\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 413 Content Too Large\r\n"))
+	assert.Contains(t, res, "Connection: close\r\n")
+	res = serveErrorHandler(t, func(w *response.Writer, req *request.Request) error {
+		return req.ParseForm()
+	}, "POST / HTTP/1.1\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 3\r\n\r\na=%")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 400 Bad Request\r\n"))
+	assert.Contains(t, res, "Connection: close\r\n")
+	res = serveErrorHandler(t, readBody, "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n0\r\nA b\r\n\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 400 Bad Request\r\n"))
+	assert.Contains(t, res, "Connection: close\r\n")
+
+	// Test: Other errors become an opaque 500
+	res = serveErrorHandler(t, func(w *response.Writer, req *request.Request) error {
+		return errors.New("database password is hunter2")
+	}, "GET / HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 500 Internal Server Error\r\n"))
+	assert.NotContains(t, res, "hunter2")
+
+	// Test: Nothing is written once the response started
+	res = serveErrorHandler(t, func(w *response.Writer, req *request.Request) error {
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(10))
+		return &HandlerError{StatusCode: response.StatusInternalServerError, Message: "late"}
+	}, "GET / HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\n"))
+	assert.NotContains(t, res, "late")
+}
+
+func TestErrorRendererOption(t *testing.T) {
+	render := func(w *response.Writer, req *request.Request, herr *HandlerError) {
+		writeError(w, herr.StatusCode, "text/plain", []byte("custom"))
+	}
+	_, addr := startTestServer(t, HandleErrors(func(w *response.Writer, req *request.Request) error {
+		return &HandlerError{StatusCode: response.StatusTeapot}
+	}), Options{ErrorRenderer: render})
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 418, res.StatusCode)
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "custom", string(body))
+}
+
+func TestHandlerPanic(t *testing.T) {
+	s, addr := startTestServer(t, func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/late" {
+			w.WriteStatusLine(response.StatusOK)
+			w.WriteHeaders(response.GetDefaultHeaders(100))
+		}
+		if req.RequestLine.RequestTarget != "/fine" {
+			panic("boom")
+		}
+		okHandler(w, req)
+	}, Options{})
+	panics := make(chan PanicInfo, 2)
+	s.OnPanic(func(info PanicInfo) { panics <- info })
+
+	// Test: A panic before the response started becomes a 500
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	_, err = conn.Write([]byte("GET /early HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	res, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 500, res.StatusCode)
+	assert.True(t, res.Close)
+	info := <-panics
+	assert.Equal(t, "boom", info.Value)
+	assert.Equal(t, "/early", info.RequestLine.RequestTarget)
+	assert.NotEmpty(t, info.Stack)
+
+	// Test: A panic mid-response aborts the connection
+	conn2, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn2.Close()
+	_, err = conn2.Write([]byte("GET /late HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	raw, err := io.ReadAll(conn2)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(raw), "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(string(raw), "\r\n\r\n"))
+	<-panics
+
+	// Test: The server keeps serving other connections
+	conn3, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn3.Close()
+	_, err = conn3.Write([]byte("GET /fine HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	res, err = http.ReadResponse(bufio.NewReader(conn3), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+}
+
+func TestReadHeaderTimeout(t *testing.T) {
+	_, addr := startTestServer(t, okHandler, Options{ReadHeaderTimeout: 100 * time.Millisecond})
+
+	// Test: A client trickling its headers gets a 408
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: "))
+	require.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 408, res.StatusCode)
+	assert.True(t, res.Close)
+
+	// Test: A connection that never sends anything is dropped silently
+	silent, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer silent.Close()
+	silent.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = silent.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestMinBodyRate(t *testing.T) {
+	_, addr := startTestServer(t, HandleErrors(func(w *response.Writer, req *request.Request) error {
+		if _, err := io.ReadAll(req.BodyReader); err != nil {
+			return err
+		}
+		okHandler(w, req)
+		return nil
+	}), Options{MinBodyRate: 1000, MinBodyRateGrace: 100 * time.Millisecond})
+
+	// Test: An upload stalling below the minimum rate gets a 408
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("POST /upload HTTP/1.1\r\nContent-Length: 100000\r\n\r\nsome"))
+	require.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 408, res.StatusCode)
+	assert.True(t, res.Close)
+}
+
+func TestMinBodyRateDefault(t *testing.T) {
+	// Test: The rate guard is on without any timeout configured
+	assert.Equal(t, DefaultMinBodyRate, Options{}.withDefaults().MinBodyRate)
+	assert.Equal(t, -1, Options{MinBodyRate: -1}.withDefaults().MinBodyRate)
+
+	// Test: A body trickled in under the default rate gets a 408
+	_, addr := startTestServer(t, HandleErrors(func(w *response.Writer, req *request.Request) error {
+		if _, err := io.ReadAll(req.BodyReader); err != nil {
+			return err
+		}
+		okHandler(w, req)
+		return nil
+	}), Options{MinBodyRateGrace: 100 * time.Millisecond})
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("POST /upload HTTP/1.1\r\nContent-Length: 100\r\n\r\nx"))
+	require.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 408, res.StatusCode)
+}
+
+func TestMinBodyRateEarned(t *testing.T) {
+	// Test: Large uploads do not overflow the earned time
+	d := &deadlineReader{rate: 1 << 20, read: 16 << 30}
+	assert.Equal(t, 16384*time.Second, d.earned())
+	d = &deadlineReader{rate: 3, read: 10}
+	assert.Equal(t, 3*time.Second+time.Second/3, d.earned())
+}
+
+func TestListenAndServe(t *testing.T) {
+	states := make(chan string, 10)
+	s := New(
+		WithAddr("127.0.0.1:0"),
+		WithHandler(okHandler),
+		WithConnStateHook(func(conn net.Conn, state string) { states <- state }),
+	)
+	done := make(chan error)
+	go func() { done <- s.ListenAndServe() }()
+	require.Eventually(t, func() bool { return s.Addr() != nil }, time.Second, 5*time.Millisecond)
+
+	// Test: The chosen port can be read back and served on
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("GET /hello HTTP/1.1\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "/hello", string(body))
+	conn.Close()
+
+	// Test: Connection hooks see the whole lifecycle
+	for _, want := range []string{ConnStateNew, ConnStateIdle, ConnStateActive, ConnStateClosed} {
+		select {
+		case got := <-states:
+			assert.Equal(t, want, got)
+		case <-time.After(time.Second):
+			t.Fatalf("missing %s state", want)
+		}
+	}
+
+	// Test: ListenAndServe returns once the server is closed
+	require.NoError(t, s.Close())
+	assert.ErrorIs(t, <-done, ERROR_SERVER_CLOSED)
+	assert.ErrorIs(t, s.ListenAndServe(), ERROR_SERVER_CLOSED)
+}
+
+func TestMultipartCleanup(t *testing.T) {
+	tmpFiles := make(chan string, 1)
+	_, addr := startTestServer(t, func(w *response.Writer, req *request.Request) {
+		req.ParseMultipartForm(1024)
+		f, _, err := req.FormFile("upload")
+		if err == nil {
+			if osFile, ok := f.(*os.File); ok {
+				tmpFiles <- osFile.Name()
+			}
+			f.Close()
+		}
+		okHandler(w, req)
+	}, Options{})
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	fw, err := mw.CreateFormFile("upload", "big.bin")
+	require.NoError(t, err)
+	fw.Write(bytes.Repeat([]byte("x"), 4096))
+	mw.Close()
+
+	// Test: Spilled upload files are removed once the handler returns
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("POST / HTTP/1.1\r\nContent-Type: " + mw.FormDataContentType() +
+		"\r\nContent-Length: " + strconv.Itoa(buf.Len()) + "\r\n\r\n"))
+	require.NoError(t, err)
+	_, err = conn.Write(buf.Bytes())
+	require.NoError(t, err)
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	io.ReadAll(res.Body)
+	name := <-tmpFiles
+	_, err = os.Stat(name)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExpectContinue(t *testing.T) {
+	_, addr := startTestServer(t, func(w *response.Writer, req *request.Request) {
+		if req.URL.Path == "/reject" {
+			w.WriteStatusLine(response.StatusRequestEntityTooLarge)
+			w.WriteHeaders(response.GetDefaultHeaders(0))
+			return
+		}
+		body, _ := req.ReadBody()
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody([]byte(body))
+	}, Options{})
+
+	// Test: 100 Continue is sent once the handler reads the body
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	_, err = conn.Write([]byte("POST /upload HTTP/1.1\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n"))
+	require.NoError(t, err)
+	line, err := br.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n", line)
+	line, _ = br.ReadString('\n')
+	assert.Equal(t, "\r\n", line)
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	res, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "hello", string(body))
+	assert.False(t, res.Close)
+
+	// Test: Rejecting before reading closes the connection without 100 Continue
+	_, err = conn.Write([]byte("POST /reject HTTP/1.1\r\nExpect: 100-continue\r\nContent-Length: 5000\r\n\r\n"))
+	require.NoError(t, err)
+	res, err = http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+	assert.True(t, res.Close)
+
+	// Test: Unknown expectations get 417
+	conn2, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn2.Close()
+	_, err = conn2.Write([]byte("POST / HTTP/1.1\r\nExpect: teapot\r\nContent-Length: 5\r\n\r\n"))
+	require.NoError(t, err)
+	res, err = http.ReadResponse(bufio.NewReader(conn2), nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusExpectationFailed, res.StatusCode)
+}
+
+func TestRequestSmuggling(t *testing.T) {
+	_, addr := startTestServer(t, okHandler, Options{})
+
+	// Test: Ambiguous framing gets a 400 and the connection is closed
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("POST / HTTP/1.1\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\nGET /smuggled HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.True(t, res.Close)
+	io.ReadAll(res.Body)
+	_, err = br.ReadByte()
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+const (
+	ConnStateNew    string = "new"
+	ConnStateActive string = "active"
+	ConnStateIdle   string = "idle"
+	ConnStateClosed string = "closed"
+)
+
+// shutdownPollInterval is how often Shutdown checks for drained connections.
+const shutdownPollInterval = 10 * time.Millisecond
+
+// Close stops accepting connections and closes every open one, abandoning
+// in-flight requests. Use Shutdown to let them finish.
+func (s *Server) Close() error {
+	s.closed.Store(true)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.closeListener()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return err
+}
+
+// closeListener must be called with s.mu held.
+func (s *Server) closeListener() error {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// Shutdown stops accepting connections, closes idle ones and waits for the
+// in-flight requests to be answered. Connections still busy when ctx is done
+// are closed forcibly and ctx.Err() is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closed.Store(true)
+	s.mu.Lock()
+	err := s.closeListener()
+	s.mu.Unlock()
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			s.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// closeIdleConns closes connections waiting for a request and reports
+// whether none are left.
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	closed := []net.Conn{}
+	for conn, state := range s.conns {
+		if state == ConnStateIdle {
+			conn.Close()
+			delete(s.conns, conn)
+			closed = append(closed, conn)
+		}
+	}
+	left := len(s.conns)
+	s.mu.Unlock()
+	for _, conn := range closed {
+		s.notifyConnState(conn, ConnStateClosed)
+	}
+	return left == 0
+}
+
+func (s *Server) trackConn(conn net.Conn) bool {
+	s.mu.Lock()
+	if s.closed.Load() {
+		s.mu.Unlock()
+		return false
+	}
+	s.conns[conn] = ConnStateNew
+	s.mu.Unlock()
+	s.notifyConnState(conn, ConnStateNew)
+	return true
+}
+
+func (s *Server) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	_, tracked := s.conns[conn]
+	delete(s.conns, conn)
+	s.mu.Unlock()
+	if tracked {
+		s.notifyConnState(conn, ConnStateClosed)
+	}
+}
+
+// setConnState records what conn is doing. It reports false once the
+// connection has been dropped by Close or Shutdown.
+func (s *Server) setConnState(conn net.Conn, state string) bool {
+	s.mu.Lock()
+	if _, ok := s.conns[conn]; !ok {
+		s.mu.Unlock()
+		return false
+	}
+	if state == ConnStateIdle && s.closed.Load() {
+		conn.Close()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.notifyConnState(conn, ConnStateClosed)
+		return false
+	}
+	s.conns[conn] = state
+	s.mu.Unlock()
+	s.notifyConnState(conn, state)
+	return true
+}
+
+func (s *Server) notifyConnState(conn net.Conn, state string) {
+	if s.config.OnConnState != nil {
+		s.config.OnConnState(conn, state)
+	}
+}
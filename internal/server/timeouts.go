@@ -0,0 +1,73 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// deadlineReader is what the request parser reads the connection through.
+// While a body is being read it enforces a minimum transfer rate by pushing
+// the read deadline forward by the time the bytes received so far have
+// earned, never past the hard deadline.
+type deadlineReader struct {
+	conn  net.Conn
+	rate  int
+	grace time.Duration
+
+	inBody bool
+	start  time.Time
+	read   int64
+	hard   time.Time
+}
+
+// earned is how long reading the body so far may have taken at MinBodyRate.
+// Whole seconds and the remainder are counted apart, since read times
+// time.Second overflows past 8 GiB.
+func (d *deadlineReader) earned() time.Duration {
+	rate := int64(d.rate)
+	return time.Duration(d.read/rate)*time.Second + time.Duration(d.read%rate)*time.Second/time.Duration(rate)
+}
+
+func (d *deadlineReader) Read(p []byte) (int, error) {
+	if d.inBody && d.rate > 0 {
+		deadline := d.start.Add(d.grace + d.earned())
+		if !d.hard.IsZero() && d.hard.Before(deadline) {
+			deadline = d.hard
+		}
+		d.conn.SetReadDeadline(deadline)
+	}
+	n, err := d.conn.Read(p)
+	d.read += int64(n)
+	return n, err
+}
+
+// waitFor sets a plain deadline for the idle and header phases.
+func (d *deadlineReader) waitFor(timeout time.Duration) {
+	d.inBody = false
+	d.conn.SetReadDeadline(after(timeout))
+}
+
+// startBody switches to the rate guard until hard, which is zero when
+// there is no overall read timeout.
+func (d *deadlineReader) startBody(hard time.Time) {
+	d.inBody = true
+	d.start = time.Now()
+	d.read = 0
+	d.hard = hard
+	d.conn.SetReadDeadline(hard)
+}
+
+// after returns the deadline timeout from now, or no deadline for a
+// non-positive timeout.
+func after(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
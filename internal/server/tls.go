@@ -0,0 +1,145 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// certReloadInterval is the minimum delay between two checks of the
+// certificate files for changes.
+var certReloadInterval = time.Second
+
+// CertificateFiles names a PEM certificate chain and its private key.
+type CertificateFiles struct {
+	CertFile string
+	KeyFile  string
+}
+
+// certReloader serves certificates loaded from files, picking one by SNI
+// and reloading all of them when a file changes on disk. A failed reload
+// keeps the previous certificates.
+type certReloader struct {
+	files  []CertificateFiles
+	logger *log.Logger
+
+	mu        sync.Mutex
+	certs     []*tls.Certificate
+	modTimes  []time.Time
+	lastCheck time.Time
+}
+
+func (cr *certReloader) load() error {
+	certs := make([]*tls.Certificate, 0, len(cr.files))
+	modTimes := make([]time.Time, 0, 2*len(cr.files))
+	for _, f := range cr.files {
+		cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+		if err != nil {
+			return fmt.Errorf("loading certificate %s: %w", f.CertFile, err)
+		}
+		certs = append(certs, &cert)
+		for _, name := range []string{f.CertFile, f.KeyFile} {
+			info, err := os.Stat(name)
+			if err != nil {
+				return err
+			}
+			modTimes = append(modTimes, info.ModTime())
+		}
+	}
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.certs = certs
+	cr.modTimes = modTimes
+	cr.lastCheck = time.Now()
+	return nil
+}
+
+// changed reports whether any file was modified since the last load.
+func (cr *certReloader) changed() bool {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if time.Since(cr.lastCheck) < certReloadInterval {
+		return false
+	}
+	cr.lastCheck = time.Now()
+	i := 0
+	for _, f := range cr.files {
+		for _, name := range []string{f.CertFile, f.KeyFile} {
+			info, err := os.Stat(name)
+			if err == nil && !info.ModTime().Equal(cr.modTimes[i]) {
+				return true
+			}
+			i++
+		}
+	}
+	return false
+}
+
+func (cr *certReloader) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if cr.changed() {
+		if err := cr.load(); err != nil {
+			cr.logger.Printf("keeping previous certificates: %v", err)
+		}
+	}
+	cr.mu.Lock()
+	certs := cr.certs
+	cr.mu.Unlock()
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate loaded")
+	}
+	for _, cert := range certs {
+		if hello.SupportsCertificate(cert) == nil {
+			return cert, nil
+		}
+	}
+	return certs[0], nil
+}
+
+// buildTLSConfig merges Config.TLSConfig with the certificate files and
+// client authentication settings. It returns nil for a plaintext server.
+func buildTLSConfig(c Config) (*tls.Config, *certReloader, error) {
+	if c.TLSConfig == nil && len(c.Certificates) == 0 {
+		return nil, nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.TLSConfig != nil {
+		tlsConfig = c.TLSConfig.Clone()
+	}
+	var reloader *certReloader
+	if len(c.Certificates) > 0 {
+		reloader = &certReloader{files: c.Certificates, logger: c.Logger}
+		tlsConfig.GetCertificate = reloader.getCertificate
+	}
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("no certificate found in %s", c.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		if c.ClientAuth == tls.NoClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	if c.ClientAuth != tls.NoClientCert {
+		tlsConfig.ClientAuth = c.ClientAuth
+	}
+	return tlsConfig, reloader, nil
+}
+
+// ListenAndServeTLS is ListenAndServe with an extra certificate, for callers
+// not going through WithCertificate. The server's config is left untouched,
+// so calling it again does not pile up certificates.
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	c := s.config
+	c.Certificates = append(slices.Clip(s.config.Certificates), CertificateFiles{CertFile: certFile, KeyFile: keyFile})
+	return s.listenAndServe(c)
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert issues a certificate for name, self-signed when parent is nil.
+func newTestCert(t *testing.T, name string, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) writeFiles(t *testing.T, dir, name string) CertificateFiles {
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	files := CertificateFiles{CertFile: filepath.Join(dir, name+".crt"), KeyFile: filepath.Join(dir, name+".key")}
+	require.NoError(t, os.WriteFile(files.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600))
+	require.NoError(t, os.WriteFile(files.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return files
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+// tlsGet sends one GET over a fresh TLS connection and returns the server
+// certificate along with the response body.
+func tlsGet(t *testing.T, addr string, cfg *tls.Config) (*x509.Certificate, string, error) {
+	conn, err := tls.Dial("tcp", addr, cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n")); err != nil {
+		return nil, "", err
+	}
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	body, err := io.ReadAll(res.Body)
+	return conn.ConnectionState().PeerCertificates[0], string(body), err
+}
+
+func TestTLS(t *testing.T) {
+	old := certReloadInterval
+	certReloadInterval = 0
+	t.Cleanup(func() { certReloadInterval = old })
+
+	dir := t.TempDir()
+	ca := newTestCert(t, "test CA", nil, x509.ExtKeyUsageAny)
+	caFile := filepath.Join(dir, "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0o600))
+	filesA := newTestCert(t, "a.test", ca, x509.ExtKeyUsageServerAuth).writeFiles(t, dir, "a")
+	filesB := newTestCert(t, "b.test", ca, x509.ExtKeyUsageServerAuth).writeFiles(t, dir, "b")
+	client := newTestCert(t, "client", ca, x509.ExtKeyUsageClientAuth)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := New(
+		WithCertificate(filesA.CertFile, filesA.KeyFile),
+		WithCertificate(filesB.CertFile, filesB.KeyFile),
+		WithClientAuth(caFile, tls.VerifyClientCertIfGiven),
+		WithHandler(func(w *response.Writer, req *request.Request) {
+			body := []byte("anonymous")
+			if cert := req.ClientCertificate(); cert != nil {
+				body = []byte(cert.Subject.CommonName)
+			}
+			w.WriteStatusLine(response.StatusOK)
+			w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+			w.WriteBody(body)
+		}),
+	)
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+	addr := l.Addr().String()
+
+	// Test: The certificate is picked by SNI
+	for _, name := range []string{"a.test", "b.test"} {
+		cert, body, err := tlsGet(t, addr, &tls.Config{RootCAs: roots, ServerName: name})
+		require.NoError(t, err)
+		assert.Equal(t, name, cert.Subject.CommonName)
+		assert.Equal(t, "anonymous", body)
+	}
+
+	// Test: A client certificate is verified and exposed on the request
+	clientCert := client.tlsCertificate()
+	_, body, err := tlsGet(t, addr, &tls.Config{RootCAs: roots, ServerName: "a.test", Certificates: []tls.Certificate{clientCert}})
+	require.NoError(t, err)
+	assert.Equal(t, "client", body)
+
+	// Test: A client certificate from an unknown CA is refused
+	rogue := newTestCert(t, "rogue", nil, x509.ExtKeyUsageClientAuth).tlsCertificate()
+	_, _, err = tlsGet(t, addr, &tls.Config{RootCAs: roots, ServerName: "a.test", GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		return &rogue, nil
+	}})
+	assert.Error(t, err)
+
+	// Test: Rewritten certificate files are picked up without a restart
+	renewed := newTestCert(t, "a.test", ca, x509.ExtKeyUsageServerAuth)
+	renewed.writeFiles(t, dir, "a")
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(filesA.CertFile, future, future))
+	cert, _, err := tlsGet(t, addr, &tls.Config{RootCAs: roots, ServerName: "a.test"})
+	require.NoError(t, err)
+	assert.Equal(t, renewed.cert.SerialNumber, cert.SerialNumber)
+
+	// Test: A broken reload keeps serving the previous certificate
+	require.NoError(t, os.WriteFile(filesA.CertFile, []byte("garbage"), 0o600))
+	require.NoError(t, os.Chtimes(filesA.CertFile, future.Add(time.Minute), future.Add(time.Minute)))
+	cert, _, err = tlsGet(t, addr, &tls.Config{RootCAs: roots, ServerName: "a.test"})
+	require.NoError(t, err)
+	assert.Equal(t, renewed.cert.SerialNumber, cert.SerialNumber)
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	// Test: Serve fails when the certificate files cannot be loaded
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := New(WithCertificate("missing.crt", "missing.key"))
+	assert.Error(t, s.Serve(l))
+
+	// Test: ListenAndServeTLS leaves the server's certificates alone
+	l, err = net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s = New(WithListener(l), WithCertificate("missing.crt", "missing.key"))
+	assert.Error(t, s.ListenAndServeTLS("other.crt", "other.key"))
+	assert.Error(t, s.ListenAndServeTLS("other.crt", "other.key"))
+	assert.Equal(t, []CertificateFiles{{CertFile: "missing.crt", KeyFile: "missing.key"}}, s.config.Certificates)
+
+	// Test: A plain tls.Config is used as is
+	ca := newTestCert(t, "self", nil, x509.ExtKeyUsageServerAuth)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	l, err = net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s = New(WithHandler(okHandler), WithTLSConfig(&tls.Config{Certificates: []tls.Certificate{ca.tlsCertificate()}}))
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+	_, body, err := tlsGet(t, l.Addr().String(), &tls.Config{RootCAs: roots, ServerName: "self"})
+	require.NoError(t, err)
+	assert.Equal(t, "/", body)
+}